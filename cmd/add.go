@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"gogetty/pkg/app"
 
 	"github.com/spf13/cobra"
 )
@@ -9,18 +10,36 @@ import (
 var addCmd = &cobra.Command{
 	Use:   "add <url>",
 	Short: "Add a dependency",
-	Long: `Add a new dependency to the project. Optionally specify a branch, commit, 
-and specific directories within the repository.`,
+	Long: `Add a new dependency to the project. Optionally specify a branch, commit 
+or version constraint, and specific directories within the repository.
+With --local, the argument is a local directory that is linked as it is.
+With --archive, the argument is the HTTP(S) URL of a zip or tarball, verified
+against the required --sha256.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) != 1 {
-			fmt.Println("Usage: gogetty add <url> [--branch branchName] [--commit commitHash] [--directory subdirPath]...")
+			fmt.Println("Usage: gogetty add <url>|--local <path>|--archive <url> --sha256 <checksum> [--strip-prefix dir] [--branch branchName] [--commit commitHash] [--version constraint] [--alias name] [--group group] [--submodules] [--lfs] [--mirror url]... [--directory subdirPath]...")
 			return
 		}
 		url := args[0]
 
 		myApp := getApp()
 
-		if err := myApp.Add(url, branchFlag, commitFlag, directoryFlags); err != nil {
+		opts := app.AddOptions{
+			Branch:      branchFlag,
+			Commit:      commitFlag,
+			Version:     versionFlag,
+			Alias:       aliasFlag,
+			Group:       groupFlag,
+			Submodules:  submodulesFlag,
+			LFS:         lfsFlag,
+			Mirrors:     mirrorFlags,
+			Directories: directoryFlags,
+			Local:       localFlag,
+			Archive:     archiveFlag,
+			SHA256:      sha256Flag,
+			StripPrefix: stripPrefixFlag,
+		}
+		if err := myApp.Add(cmd.Context(), url, opts); err != nil {
 			fmt.Println("Error:", err)
 		} else {
 			fmt.Println("Dependency added successfully")
@@ -33,5 +52,15 @@ func init() {
 
 	addCmd.Flags().StringVar(&branchFlag, "branch", "", "Specify the branch of the repository")
 	addCmd.Flags().StringVar(&commitFlag, "commit", "", "Specify the commit hash of the repository")
+	addCmd.Flags().StringVar(&versionFlag, "version", "", "Specify a semantic version constraint, such as ^1.2, resolved against the repository's tags")
+	addCmd.Flags().StringVar(&aliasFlag, "alias", "", "Specify the name the dependency is linked and referred to by, instead of the repository name")
+	addCmd.Flags().StringVar(&groupFlag, "group", "", "Specify a group, such as dev, that fetch can include or leave out")
+	addCmd.Flags().BoolVar(&submodulesFlag, "submodules", false, "Initialize the repository's submodules when fetching it")
+	addCmd.Flags().BoolVar(&lfsFlag, "lfs", false, "Download the repository's Git LFS objects when fetching it")
+	addCmd.Flags().BoolVar(&localFlag, "local", false, "Link a local directory, absolute or relative to the project, instead of cloning a repository")
+	addCmd.Flags().BoolVar(&archiveFlag, "archive", false, "Download a zip or tarball over HTTP(S) instead of cloning a repository")
+	addCmd.Flags().StringVar(&sha256Flag, "sha256", "", "Specify the SHA-256 checksum an archive must match")
+	addCmd.Flags().StringVar(&stripPrefixFlag, "strip-prefix", "", "Specify the directory inside an archive that is used as its root")
+	addCmd.Flags().StringSliceVar(&mirrorFlags, "mirror", nil, "Specify mirror URLs tried in order when the repository can't be fetched")
 	addCmd.Flags().StringSliceVar(&directoryFlags, "directory", nil, "Specify subdirectories within the repository")
 }
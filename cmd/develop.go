@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var developCmd = &cobra.Command{
+	Use:   "develop <name> <path>",
+	Short: "Link a local working copy in place of a dependency",
+	Long: `Temporarily replace a dependency with a local working copy, absolute or relative to 
+the project. The override is recorded in the untracked .gogetty.user file, so the .gogetty and 
+.gogetty.lock files are left as they are. The next fetch links the working copy instead of the 
+cached clone, until 'gogetty undevelop' restores the pinned version.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		myApp := getApp()
+		if err := myApp.Develop(args[0], args[1]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("'%s' is now overridden by %s, run 'gogetty fetch' to link it\n", args[0], args[1])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(developCmd)
+}
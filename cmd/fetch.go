@@ -2,20 +2,43 @@ package cmd
 
 import (
 	"fmt"
+	"gogetty/pkg/app"
+	"gogetty/pkg/project"
+	"os"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	frozenFlag        bool
+	offlineFlag       bool
+	fetchJobsFlag     int
+	fetchWithFlags    []string
+	fetchWithoutFlags []string
+)
+
 var fetchCmd = &cobra.Command{
 	Use:   "fetch",
 	Short: "Fetch dependencies",
-	Long:  "Fetch all dependencies defined in your project",
+	Long: `Fetch all dependencies defined in your project, and record the exact 
+commit each one resolved to in the .gogetty.lock file.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		myApp := getApp()
 
+		opts := app.FetchOptions{
+			Frozen:  frozenFlag,
+			Offline: offlineFlag,
+			Jobs:    fetchJobsFlag,
+			Groups: project.GroupFilter{
+				With:    fetchWithFlags,
+				Without: fetchWithoutFlags,
+			},
+		}
+
 		// Perform the fetch operation
-		if err := myApp.Fetch(); err != nil {
+		if err := myApp.Fetch(cmd.Context(), opts); err != nil {
 			fmt.Println("Error:", err)
+			os.Exit(1)
 		} else {
 			fmt.Println("Dependencies fetched successfully")
 		}
@@ -24,4 +47,10 @@ var fetchCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(fetchCmd)
+
+	fetchCmd.Flags().StringSliceVar(&fetchWithFlags, "with", nil, "Only link these groups besides dependencies without a group")
+	fetchCmd.Flags().StringSliceVar(&fetchWithoutFlags, "without", nil, "Don't link dependencies in these groups")
+	fetchCmd.Flags().IntVarP(&fetchJobsFlag, "jobs", "j", 4, "Clone and check out up to this many dependencies at once")
+	fetchCmd.Flags().BoolVar(&offlineFlag, "offline", false, "Use only modules already in the cache, failing with the ones that are missing")
+	fetchCmd.Flags().BoolVar(&frozenFlag, "frozen", false, "Install exactly what the lockfile records, failing if it is missing or out of date")
 }
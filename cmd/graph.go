@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var graphFormatFlag string
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Print the dependency graph",
+	Long: `Resolve every dependency of the project, including the dependencies of its 
+dependencies, and print the resulting tree as indented text, Graphviz DOT or JSON.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		myApp := getApp()
+		if err := myApp.Graph(cmd.Context(), graphFormatFlag); err != nil {
+			fmt.Println("Error:", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+
+	graphCmd.Flags().StringVar(&graphFormatFlag, "format", "text", "Output format: text, dot or json")
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"gogetty/pkg/app"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var outdatedFormatFlag string
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "List dependencies behind their upstream",
+	Long: `Ask the remote of every dependency for the tip of its branch and its newest tags, and 
+compare them with what the .gogetty.lock file pins. Nothing is changed, see 'gogetty upgrade' for that.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		myApp := getApp()
+		if err := myApp.Outdated(cmd.Context(), outdatedFormatFlag); err != nil {
+			// The report already lists the dependencies that couldn't be checked
+			if !errors.Is(err, app.ErrUnchecked) {
+				fmt.Println("Error:", err)
+			}
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(outdatedCmd)
+
+	outdatedCmd.Flags().StringVar(&outdatedFormatFlag, "format", "text", "Output format: text or json")
+}
@@ -1,16 +1,29 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
 
 // Declare flags at the package level
 var (
-	branchFlag     string
-	commitFlag     string
-	directoryFlags []string
+	branchFlag      string
+	commitFlag      string
+	versionFlag     string
+	aliasFlag       string
+	groupFlag       string
+	submodulesFlag  bool
+	lfsFlag         bool
+	localFlag       bool
+	archiveFlag     bool
+	sha256Flag      string
+	stripPrefixFlag string
+	directoryFlags  []string
+	mirrorFlags     []string
 )
 
 var rootCmd = &cobra.Command{
@@ -22,15 +35,29 @@ Versioning is supported through the use of commit hashes.
 Examples of using GoGetty:
 
 - Initialize a new project: gogetty init
-- Add a dependency to your project: gogetty add <git-repo-url> [--branch <branchName>] [--commit <commitHash>] [--directory <commaSeperatedDirectories>]
-- Update a dependency: gogetty update <dependencyName> [--branch <branchName>] [--commit <commitHash>] [--directory <commaSeperatedDirectories>]
+- Add a dependency to your project: gogetty add <git-repo-url> [--branch <branchName>] [--commit <commitHash>] [--version <constraint>] [--alias <name>] [--group <group>] [--submodules] [--lfs] [--mirror <url>] [--directory <commaSeperatedDirectories>]
+- Link a local directory as a dependency: gogetty add --local <path> [--alias <name>] [--group <group>] [--directory <commaSeperatedDirectories>]
+- Add a zip or tarball as a dependency: gogetty add --archive <url> --sha256 <checksum> [--strip-prefix <dir>] [--alias <name>] [--group <group>] [--directory <commaSeperatedDirectories>]
+- Update a dependency: gogetty update <dependencyName> [--branch <branchName>] [--commit <commitHash>] [--version <constraint>] [--mirror <url>] [--directory <commaSeperatedDirectories>]
 - Remove a dependency: gogetty remove <dependencyName>
 - Clean up dependencies, and remove unused modules from the cache: gogetty clean
-- Fetch all dependencies, downloading missing modules to the cache, and creating symbolic links: gogetty fetch`,
+- Fetch all dependencies, downloading missing modules to the cache, and creating symbolic links: gogetty fetch [--frozen] [--offline] [--jobs <n>] [--with <groups>] [--without <groups>]
+- Print the resolved dependency tree: gogetty graph [--format text|dot|json]
+- Explain why a dependency is included: gogetty why <dependencyName>
+- Check the fetched modules against the lockfile: gogetty verify
+- Check whether the project is in sync with its manifest and lockfile: gogetty status [--format text|json] [--with <groups>] [--without <groups>]
+- List dependencies with newer commits or tags upstream: gogetty outdated [--format text|json]
+- Move dependencies to their newest allowed revision: gogetty upgrade <dependencyName>... [--all] [--jobs <n>] [--with <groups>] [--without <groups>]
+- Link a local working copy in place of a dependency: gogetty develop <dependencyName> <path>
+- Restore the pinned version of a dependency: gogetty undevelop <dependencyName>`,
 }
 
 func Execute() {
-	err := rootCmd.Execute()
+	// Ctrl-C cancels the running git commands, which clean up after themselves
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
 	}
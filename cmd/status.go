@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"gogetty/pkg/app"
+	"gogetty/pkg/project"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusFormatFlag   string
+	statusWithFlags    []string
+	statusWithoutFlags []string
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check whether the project is in sync",
+	Long: `Compare the .gogetty manifest, the .gogetty.lock file, the cache and the links in the 
+project: for every dependency, whether its cache clone exists, has the locked commit checked out 
+and is free of local changes, and whether its links point at it. Exits with a non-zero status 
+when anything is out of sync.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		myApp := getApp()
+		groups := project.GroupFilter{
+			With:    statusWithFlags,
+			Without: statusWithoutFlags,
+		}
+		if err := myApp.Status(statusFormatFlag, groups); err != nil {
+			// The report already lists what is out of sync
+			if !errors.Is(err, app.ErrOutOfSync) {
+				fmt.Println("Error:", err)
+			}
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().StringVar(&statusFormatFlag, "format", "text", "Output format: text or json")
+	statusCmd.Flags().StringSliceVar(&statusWithFlags, "with", nil, "Only expect links for these groups besides dependencies without a group")
+	statusCmd.Flags().StringSliceVar(&statusWithoutFlags, "without", nil, "Don't expect links for dependencies in these groups")
+}
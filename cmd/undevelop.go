@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var undevelopCmd = &cobra.Command{
+	Use:   "undevelop <name>",
+	Short: "Stop overriding a dependency with a local working copy",
+	Long:  "Drop the override 'gogetty develop' recorded for a dependency, so that the next fetch links the version the lockfile pins again.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		myApp := getApp()
+		if err := myApp.Undevelop(args[0]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("'%s' is no longer overridden, run 'gogetty fetch' to restore the pinned version\n", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undevelopCmd)
+}
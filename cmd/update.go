@@ -9,21 +9,23 @@ import (
 var (
 	newBranchFlag     string
 	newCommitFlag     string
+	newVersionFlag    string
 	newDirectoryFlags []string
+	newMirrorFlags    []string
 )
 
 var updateCmd = &cobra.Command{
 	Use:   "update <name>",
 	Short: "Update a dependency",
-	Long:  "Update a dependency in the project. Optionally specify a new branch, new commit, and new directories.",
+	Long:  "Update a dependency in the project. Optionally specify a new branch, new commit, new version constraint, and new directories.",
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) != 1 {
-			fmt.Println("Usage: gogetty update <name> [--branch branchName] [--commit commitHash] [--directory subdirPath]...")
+			fmt.Println("Usage: gogetty update <name> [--branch branchName] [--commit commitHash] [--version constraint] [--mirror url]... [--directory subdirPath]...")
 			return
 		}
 		name := args[0]
 		myApp := getApp()
-		if err := myApp.Update(name, newBranchFlag, newCommitFlag, newDirectoryFlags); err != nil {
+		if err := myApp.Update(cmd.Context(), name, newBranchFlag, newCommitFlag, newVersionFlag, newDirectoryFlags, newMirrorFlags); err != nil {
 			fmt.Println("Error:", err)
 		} else {
 			fmt.Printf("Dependency '%s' updated successfully\n", name)
@@ -36,5 +38,7 @@ func init() {
 
 	updateCmd.Flags().StringVar(&newBranchFlag, "branch", "", "Specify the new branch of the dependency")
 	updateCmd.Flags().StringVar(&newCommitFlag, "commit", "", "Specify the new commit of the dependency")
+	updateCmd.Flags().StringVar(&newVersionFlag, "version", "", "Specify the new semantic version constraint of the dependency")
+	updateCmd.Flags().StringSliceVar(&newMirrorFlags, "mirror", nil, "Specify new mirror URLs, replacing the dependency's")
 	updateCmd.Flags().StringSliceVar(&newDirectoryFlags, "directory", nil, "Specify new subdirectories within the repository")
 }
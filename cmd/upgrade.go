@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"gogetty/pkg/app"
+	"gogetty/pkg/project"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	upgradeAllFlag      bool
+	upgradeJobsFlag     int
+	upgradeWithFlags    []string
+	upgradeWithoutFlags []string
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [name...]",
+	Short: "Move dependencies to their newest allowed revision",
+	Long: `Move dependencies to the newest revision their entry in the .gogetty file allows: the 
+highest tag satisfying their version constraint, or else the tip of their branch. Commits pinned 
+in the .gogetty file are rewritten, the project is fetched again, and the commits between the old 
+and new revision of each dependency are listed for review.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		myApp := getApp()
+
+		opts := app.FetchOptions{
+			Jobs: upgradeJobsFlag,
+			Groups: project.GroupFilter{
+				With:    upgradeWithFlags,
+				Without: upgradeWithoutFlags,
+			},
+		}
+		if err := myApp.Upgrade(cmd.Context(), args, upgradeAllFlag, opts); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+
+	upgradeCmd.Flags().BoolVar(&upgradeAllFlag, "all", false, "Upgrade every dependency")
+	upgradeCmd.Flags().IntVarP(&upgradeJobsFlag, "jobs", "j", 4, "Clone and check out up to this many dependencies at once")
+	upgradeCmd.Flags().StringSliceVar(&upgradeWithFlags, "with", nil, "Only link these groups besides dependencies without a group")
+	upgradeCmd.Flags().StringSliceVar(&upgradeWithoutFlags, "without", nil, "Don't link dependencies in these groups")
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the fetched modules",
+	Long: `Check that every module in the .gogetty.lock file is in the cache at the locked 
+revision, and that no Git LFS pointer files or empty submodules were left in place of their content.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		myApp := getApp()
+		if err := myApp.Verify(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
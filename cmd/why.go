@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var whyCmd = &cobra.Command{
+	Use:   "why <name>",
+	Short: "Explain why a dependency is included",
+	Long:  "Print every chain of .gogetty manifests leading from the project to a dependency, with the revision each step declared.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		myApp := getApp()
+		if err := myApp.Why(cmd.Context(), args[0]); err != nil {
+			fmt.Println("Error:", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whyCmd)
+}
@@ -1,25 +1,33 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"gogetty/pkg/archive"
 	"gogetty/pkg/cache"
 	"gogetty/pkg/gitop"
+	"gogetty/pkg/progress"
 	"gogetty/pkg/project"
+	"gogetty/pkg/resolve"
 	"gogetty/pkg/symlink"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 type App interface {
 	Init() error
-	Add(url, branch, commit string, directories []string) error
+	Add(ctx context.Context, url string, opts AddOptions) error
 	Remove(name string) error
-	Fetch() error
-	Update(name, branch, commit string, directories []string) error
-	List() ([]project.Dependency, error)
+	Fetch(ctx context.Context, opts FetchOptions) error
+	Update(ctx context.Context, name, branch, commit, version string, directories, mirrors []string) error
+	List() error
 	Clean() error
 }
 
+var _ App = (*MyApp)(nil)
+
 type MyApp struct {
 	ProjectDir string
 	Cache      []gitop.GitRepo
@@ -44,49 +52,187 @@ func (m *MyApp) Init() error {
 	return nil
 }
 
-func (m *MyApp) Add(url, branch, commit string, directories []string) error {
+// AddOptions describes the dependency Add adds.
+type AddOptions struct {
+	Branch      string
+	Commit      string
+	Version     string   // Semantic version constraint, resolved against the remote's tags
+	Alias       string   // Name the dependency is linked and referred to by, instead of its own
+	Group       string   // Group, such as "dev", that fetch can include or leave out
+	Submodules  bool     // Initialize the repository's submodules
+	LFS         bool     // Download the repository's Git LFS objects
+	Mirrors     []string // URLs tried in order when the repository's own can't be fetched
+	Directories []string // Directories selected from the dependency, as from or from:to
+
+	Local       bool   // The URL is a local directory, linked as it is
+	Archive     bool   // The URL is a zip or tarball downloaded over HTTP(S)
+	SHA256      string // Checksum the archive must match
+	StripPrefix string // Directory inside the archive used as its root
+}
+
+func (m *MyApp) Add(ctx context.Context, url string, opts AddOptions) error {
 	err := ValidateEnvironment()
 	if err != nil {
 		return err
 	}
-	err = project.Validate("")
+	err = validateProject("")
 	if err != nil {
 		return err
 	}
 
+	repoOnly := opts.Branch != "" || opts.Commit != "" || opts.Version != "" || opts.Submodules || opts.LFS || len(opts.Mirrors) > 0
+	if opts.Local {
+		if repoOnly {
+			return fmt.Errorf("a local dependency is linked as it is, it can't have a branch, commit, version, mirrors, submodules or LFS")
+		}
+		return m.addLocal(url, opts)
+	}
+	if opts.Archive {
+		if repoOnly {
+			return fmt.Errorf("an archive is pinned by its checksum, it can't have a branch, commit, version, mirrors, submodules or LFS")
+		}
+		return m.addArchive(ctx, project.Archive{URL: url, SHA256: opts.SHA256, StripPrefix: opts.StripPrefix}, opts)
+	}
+	if opts.SHA256 != "" || opts.StripPrefix != "" {
+		return fmt.Errorf("--sha256 and --strip-prefix only apply to archives, pass --archive")
+	}
+
+	if opts.Version != "" {
+		if opts.Commit != "" {
+			return fmt.Errorf("a dependency can't be pinned to both a version and a commit")
+		}
+		tag, err := gitop.ResolveVersion(ctx, url, opts.Mirrors, opts.Version)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Resolved version %s to %s (%s)\n", opts.Version, tag.Name, tag.Commit)
+	}
+
 	repo := gitop.GitRepo{
 		URL:    url,
-		Branch: branch,
-		Commit: commit,
+		Branch: opts.Branch,
+		Commit: opts.Commit,
+		Name:   gitop.GetNameFromURL(url),
 	}
 
-	return project.AddDependency(repo, directories)
+	dirs, err := project.ParseDirectories(opts.Directories)
+	if err != nil {
+		return err
+	}
+
+	dep := project.Dependency{
+		Repository:  repo,
+		Alias:       opts.Alias,
+		Version:     opts.Version,
+		Group:       opts.Group,
+		Submodules:  opts.Submodules,
+		LFS:         opts.LFS,
+		Mirrors:     opts.Mirrors,
+		Directories: dirs,
+	}
+
+	return project.AddDependency(dep)
 }
 
-func (m *MyApp) Update(name, branch, commit string, directories []string) error {
+// addLocal adds a dependency on a local directory. The path is stored as given, so
+// that a relative one keeps working wherever the project is checked out.
+func (m *MyApp) addLocal(dirPath string, opts AddOptions) error {
+	dep := project.Dependency{Path: filepath.ToSlash(filepath.Clean(dirPath)), Alias: opts.Alias, Group: opts.Group}
+	dir := dep.LocalDir(m.ProjectDir)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("local directory %s not found", dir)
+	}
+	dep.Repository.Name = filepath.Base(dir)
+
+	dirs, err := project.ParseDirectories(opts.Directories)
+	if err != nil {
+		return err
+	}
+	dep.Directories = dirs
+
+	return project.AddDependency(dep)
+}
+
+// addArchive adds a dependency on an archive, downloading it right away so that a
+// wrong checksum or strip prefix is reported now rather than on the next fetch.
+func (m *MyApp) addArchive(ctx context.Context, a project.Archive, opts AddOptions) error {
+	if a.SHA256 == "" {
+		return fmt.Errorf("an archive dependency requires --sha256")
+	}
+	if _, err := fetchArchive(ctx, a); err != nil {
+		return err
+	}
+
+	dep := project.Dependency{Archive: &a, Alias: opts.Alias, Group: opts.Group}
+	dep.Repository.Name = archive.Name(a.URL)
+
+	dirs, err := project.ParseDirectories(opts.Directories)
+	if err != nil {
+		return err
+	}
+	dep.Directories = dirs
+
+	return project.AddDependency(dep)
+}
+
+func (m *MyApp) Update(ctx context.Context, name, branch, commit, version string, directories, mirrors []string) error {
 	err := ValidateEnvironment()
 	if err != nil {
 		return err
 	}
-	err = project.Validate("")
+	err = validateProject("")
+	if err != nil {
+		return err
+	}
+
+	dep, err := project.Find(name)
+	if err != nil {
+		return err
+	}
+
+	if !dep.IsRepository() && (branch != "" || commit != "" || version != "" || mirrors != nil) {
+		return fmt.Errorf("'%s' isn't a git repository, only its directories can be updated", name)
+	}
+
+	// Mirrors given here replace the dependency's own
+	if mirrors == nil {
+		mirrors = dep.Mirrors
+	}
+
+	if version != "" {
+		if commit != "" {
+			return fmt.Errorf("a dependency can't be pinned to both a version and a commit")
+		}
+		tag, err := gitop.ResolveVersion(ctx, dep.Repository.URL, mirrors, version)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Resolved version %s to %s (%s)\n", version, tag.Name, tag.Commit)
+	}
+
+	dirs, err := project.ParseDirectories(directories)
 	if err != nil {
 		return err
 	}
 
 	repo := gitop.GitRepo{
-		Name:   name,
+		URL:    dep.Repository.URL,
+		Name:   dep.Repository.Name,
 		Branch: branch,
 		Commit: commit,
 	}
 
 	new_dep := project.Dependency{
 		Repository:  repo,
-		Directories: directories,
-	}
-
-	dep, err := project.Find(name)
-	if err != nil {
-		return err
+		Path:        dep.Path,
+		Archive:     dep.Archive,
+		Alias:       dep.Alias,
+		Version:     version,
+		Group:       dep.Group,
+		Submodules:  dep.Submodules,
+		LFS:         dep.LFS,
+		Mirrors:     mirrors,
+		Directories: dirs,
 	}
 
 	return project.UpdateDependency(dep, new_dep)
@@ -98,7 +244,7 @@ func (m *MyApp) Remove(name string) error {
 	if err != nil {
 		return err
 	}
-	err = project.Validate("")
+	err = validateProject("")
 	if err != nil {
 		return err
 	}
@@ -106,14 +252,25 @@ func (m *MyApp) Remove(name string) error {
 	return project.RemoveDependency(name)
 }
 
-func (m *MyApp) Fetch() error {
+// FetchOptions controls how Fetch resolves dependencies.
+type FetchOptions struct {
+	Frozen  bool                // Install exactly what the lockfile records, failing if it is missing or out of date
+	Groups  project.GroupFilter // Selects which groups of dependencies are linked
+	Offline bool                // Resolve from the module cache alone, without contacting any remote
+	Jobs    int                 // Modules cloned and checked out at once
+
+	// Commits that dependencies without a commit or version move to, by normalized URL
+	Upgrades map[string]string
+}
+
+func (m *MyApp) Fetch(ctx context.Context, opts FetchOptions) (err error) {
 	// Validate the environment
 	if err := ValidateEnvironment(); err != nil {
 		return err
 	}
 
 	// Validate the project
-	if err := project.Validate(""); err != nil {
+	if err := validateProject(""); err != nil {
 		return err
 	}
 
@@ -123,6 +280,74 @@ func (m *MyApp) Fetch() error {
 		return projErr
 	}
 
+	if opts.Offline {
+		gitop.UseOffline(true)
+	}
+	if opts.Jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+
+	// Overrides only change what is linked, the lock still records what the manifest resolves to
+	overrides, err := project.GetOverrides(m.ProjectDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range staleOverrides(proj, overrides) {
+		fmt.Printf("Ignoring the override of '%s', it isn't a dependency of the project, run 'gogetty undevelop %s'\n", name, name)
+		delete(overrides.Develop, name)
+	}
+	for name := range overrides.Develop {
+		dir, _ := overrides.Dir(m.ProjectDir, name)
+		fmt.Printf("Linking '%s' from the working copy at %s, run 'gogetty undevelop %s' to restore it\n", name, dir, name)
+	}
+
+	// Whatever happens, every dependency shown ends up done or failed
+	prog := progress.New()
+	defer func() { prog.Finish(err) }()
+
+	// Messages printed while cloning and linking go above the progress lines
+	gitop.UseOutput(prog)
+	defer gitop.UseOutput(os.Stdout)
+
+	// Excluded groups are neither resolved nor cloned, the lock keeps what it had for them
+	resolver := &resolve.Resolver{
+		Cache:    m.Cache,
+		Groups:   opts.Groups,
+		Jobs:     opts.Jobs,
+		Progress: prog,
+		Upgrades: opts.Upgrades,
+	}
+	if lock, err := project.GetLockFile(m.ProjectDir); err == nil {
+		resolver.Locked = &lock
+	}
+
+	// A frozen fetch never re-resolves, so the lock has to match the manifest up front
+	if opts.Frozen {
+		lock, err := project.GetLockFile(m.ProjectDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("--frozen requires %s, run 'gogetty fetch' to create it", project.LockJson)
+			}
+			return err
+		}
+		if err := project.VerifyLock(proj, lock); err != nil {
+			return fmt.Errorf("%s is out of date: %w", project.LockJson, err)
+		}
+		resolver.Frozen = &lock
+	}
+
+	// Resolve the whole graph before touching the project's links
+	graph, err := resolver.Resolve(ctx, m.ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	// Archives are pinned by their checksum, so they are downloaded outside of the graph
+	archives, err := fetchArchives(ctx, proj, opts.Groups, prog)
+	if err != nil {
+		return err
+	}
+
 	// Determine the target directory
 	targetDir := filepath.Join(m.ProjectDir, proj.ModulesDir)
 
@@ -133,25 +358,57 @@ func (m *MyApp) Fetch() error {
 		}
 	}
 
-	proj, err := project.GetProjectFile("")
+	// Mapped directories live outside targetDir, so the lock remembers them for cleanup
+	var previousLinks []string
+	if previous, err := project.GetLockFile(m.ProjectDir); err == nil {
+		previousLinks = previous.Links
+	}
 
 	if len(proj.Dependencies) == 0 {
-		if err == nil {
-			gitop.RemoveIgnore(m.ProjectDir, proj.ModulesDir)
+		unlinkStale(m.ProjectDir, previousLinks, nil, prog)
+		gitop.RemoveIgnore(m.ProjectDir, proj.ModulesDir)
+		if !opts.Frozen {
+			return project.WriteLockFile(m.ProjectDir, graph.Lock(cache.ModuleDir()))
 		}
 		return nil
 	} else {
-		if err == nil {
-			gitop.Ignore(m.ProjectDir, proj.ModulesDir)
-		}
+		gitop.Ignore(m.ProjectDir, proj.ModulesDir)
+	}
+
+	// Link every module of the selected groups into the manifest that declared it
+	links, err := linkGraph(graph.Select(opts.Groups), m.ProjectDir, overrides, prog)
+
+	// Local dependencies and archives aren't part of the graph, they are linked as they are
+	localLinks, localErr := linkLocal(m.ProjectDir, proj, opts.Groups, archives, prog)
+	links = append(links, localLinks...)
+	if err == nil {
+		err = localErr
 	}
 
-	// Perform recursive fetch
-	if err := fetchRecursive(m.ProjectDir, m.Cache); err != nil {
+	unlinkStale(m.ProjectDir, previousLinks, links, prog)
+	if len(links) > 0 {
+		gitop.Ignore(m.ProjectDir, links...)
+	}
+	if err != nil {
 		return err
 	}
 
+	// Record what was resolved, leaving the manifest as the user wrote it
+	if !opts.Frozen {
+		lock := graph.Lock(cache.ModuleDir())
+		if !opts.Groups.Empty() {
+			lock = keepExcluded(lock, resolver.Locked, proj)
+		}
+		lock.Links = links
+		if err := project.WriteLockFile(m.ProjectDir, lock); err != nil {
+			return fmt.Errorf("failed to write %s: %w", project.LockJson, err)
+		}
+	}
+
 	// Write a warning file after successful fetching
+	if err := ensureDir(targetDir); err != nil {
+		return err
+	}
 	if err := symlink.WriteReadmeWithWarning(targetDir); err != nil {
 		return fmt.Errorf("failed to write warning file: %w", err)
 	}
@@ -165,7 +422,7 @@ func (m *MyApp) List() error {
 		return err
 	}
 
-	err = project.Validate("")
+	err = validateProject("")
 	if err != nil {
 		return err
 	}
@@ -181,9 +438,17 @@ func (m *MyApp) List() error {
 		return nil
 	}
 
+	overrides, err := project.GetOverrides("")
+	if err != nil {
+		return err
+	}
+
 	fmt.Println("Dependencies:")
 	for _, dep := range proj.Dependencies {
-		printDependency(dep)
+		printDependency(dep, overrides.Develop[dep.Name()])
+	}
+	for _, name := range staleOverrides(proj, overrides) {
+		fmt.Printf("Override of '%s' in %s matches no dependency, run 'gogetty undevelop %s'\n", name, project.OverridesJson, name)
 	}
 	return nil
 }
@@ -201,8 +466,11 @@ func (m *MyApp) Clean() error {
 	// Store project directories that should be deleted
 	directoriesToDelete := []string{}
 
-	// Store dependencies of projects with a .gogetty file
+	// Store dependencies of projects with a .gogetty file. Projects with a lockfile
+	// keep exactly the clones it records, others keep every clone of their URLs
 	dependencies := map[string]project.Dependency{}
+	lockedPaths := map[string]bool{}
+	archives := map[string]bool{}
 
 	// Iterate over each project directory
 	for _, client := range clients {
@@ -213,10 +481,24 @@ func (m *MyApp) Clean() error {
 			directoriesToDelete = append(directoriesToDelete, client)
 		} else if err == nil {
 			// .gogetty file exists, read its dependencies
-			project, projErr := project.GetProjectFile(client)
+			proj, projErr := project.GetProjectFile(client)
+			lock, lockErr := project.GetLockFile(client)
 			if projErr == nil {
-				for _, dep := range project.Dependencies {
-					dependencies[dep.Repository.URL] = dep
+				for _, dep := range proj.Dependencies {
+					if dep.IsArchive() {
+						archives[archive.Dir(dep.Archive.SHA256)] = true
+					}
+				}
+			}
+			if projErr == nil && lockErr == nil {
+				for _, mod := range lock.Modules {
+					lockedPaths[filepath.Join(cache.ModuleDir(), filepath.FromSlash(mod.Path))] = true
+				}
+			} else if projErr == nil {
+				for _, dep := range proj.Dependencies {
+					if dep.IsRepository() {
+						dependencies[gitop.NormalizeURL(dep.Repository.URL)] = dep
+					}
 				}
 			} else {
 				// Handle error reading .gogetty file if needed
@@ -227,7 +509,7 @@ func (m *MyApp) Clean() error {
 
 	// Iterate over all modules and check if they have dependents
 	for _, module := range m.Cache {
-		if _, exists := dependencies[module.URL]; !exists {
+		if _, exists := dependencies[gitop.NormalizeURL(module.URL)]; !exists && !lockedPaths[module.Path] {
 			// Module has no dependents, remove it from the cache
 			if err := cache.Remove(module.Path); err != nil {
 				// Handle removal error if needed
@@ -236,6 +518,18 @@ func (m *MyApp) Clean() error {
 		}
 	}
 
+	// Remove archives no project declares any more
+	if entries, err := os.ReadDir(cache.ArchiveDir()); err == nil {
+		for _, entry := range entries {
+			dir := filepath.Join(cache.ArchiveDir(), entry.Name())
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && !archives[dir] {
+				if err := cache.Remove(dir); err != nil {
+					fmt.Printf("Error removing archive from cache: %v\n", err)
+				}
+			}
+		}
+	}
+
 	// Delete project directories with no .gogetty file
 	for _, dir := range directoriesToDelete {
 		if err := os.RemoveAll(dir); err != nil {
@@ -244,5 +538,13 @@ func (m *MyApp) Clean() error {
 		}
 	}
 
+	// Delete clones left behind by fetches that were killed mid-clone
+	if err := gitop.RemoveStaleClones(cache.ModuleDir(), time.Hour); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error removing unfinished clones: %v\n", err)
+	}
+	if err := gitop.RemoveStaleClones(cache.ArchiveDir(), time.Hour); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error removing unfinished archives: %v\n", err)
+	}
+
 	return nil
 }
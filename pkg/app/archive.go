@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"gogetty/pkg/archive"
+	"gogetty/pkg/progress"
+	"gogetty/pkg/project"
+)
+
+// fetchArchives downloads the archives of the project that the groups select into
+// the cache, and returns the directory each one is linked from, by name.
+func fetchArchives(ctx context.Context, proj project.Project, groups project.GroupFilter, prog *progress.Progress) (map[string]string, error) {
+	var allErrors []error
+	sources := map[string]string{}
+
+	for _, dep := range proj.Dependencies {
+		if !dep.IsArchive() || !groups.Includes(dep) {
+			continue
+		}
+		prog.Update(dep.Source(), dep.Name(), progress.Downloading)
+		source, err := fetchArchive(ctx, *dep.Archive)
+		if err != nil {
+			prog.Update(dep.Source(), dep.Name(), progress.Failed)
+			allErrors = append(allErrors, fmt.Errorf("error fetching %s: %v", dep.Name(), err))
+			continue
+		}
+		sources[dep.Name()] = source
+	}
+
+	if len(allErrors) > 0 {
+		return sources, fmt.Errorf("multiple errors occurred: %v", allErrors)
+	}
+
+	return sources, nil
+}
+
+// fetchArchive downloads and extracts an archive, returning the directory its
+// strip prefix selects.
+func fetchArchive(ctx context.Context, a project.Archive) (string, error) {
+	if err := a.Validate(); err != nil {
+		return "", err
+	}
+	dir, err := archive.Fetch(ctx, a.URL, a.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return archiveSource(dir, a)
+}
+
+// archiveSource returns the directory an extracted archive is linked from.
+func archiveSource(dir string, a project.Archive) (string, error) {
+	source, err := archive.Source(dir, a.StripPrefix)
+	if err != nil {
+		return "", fmt.Errorf("%v in %s", err, a.URL)
+	}
+	return source, nil
+}
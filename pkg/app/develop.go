@@ -0,0 +1,96 @@
+package app
+
+import (
+	"fmt"
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/project"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Develop overrides a dependency of the project with a local working copy, which
+// fetch links in place of its cache clone. The override is recorded in the user's
+// own overrides file, leaving the manifest and lockfile untouched.
+func (m *MyApp) Develop(name, dirPath string) error {
+	err := ValidateEnvironment()
+	if err != nil {
+		return err
+	}
+	err = validateProject("")
+	if err != nil {
+		return err
+	}
+
+	proj, err := project.GetProjectFile(m.ProjectDir)
+	if err != nil {
+		return err
+	}
+	dep, err := findDependency(proj, name)
+	if err != nil {
+		return err
+	}
+	if !dep.IsRepository() {
+		return fmt.Errorf("'%s' isn't a git repository, only repositories can be overridden", name)
+	}
+
+	overrides, err := project.GetOverrides(m.ProjectDir)
+	if err != nil {
+		return err
+	}
+	if overrides.Develop == nil {
+		overrides.Develop = map[string]string{}
+	}
+	overrides.Develop[name] = filepath.ToSlash(filepath.Clean(dirPath))
+
+	dir, _ := overrides.Dir(m.ProjectDir, name)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("working copy %s not found", dir)
+	}
+
+	if err := project.WriteOverrides(m.ProjectDir, overrides); err != nil {
+		return fmt.Errorf("failed to write %s: %w", project.OverridesJson, err)
+	}
+	gitop.Ignore(m.ProjectDir, project.OverridesJson)
+	return nil
+}
+
+// Undevelop drops the override of a dependency, so that the next fetch links the
+// revision the lockfile pins again.
+func (m *MyApp) Undevelop(name string) error {
+	err := ValidateEnvironment()
+	if err != nil {
+		return err
+	}
+	err = validateProject("")
+	if err != nil {
+		return err
+	}
+
+	overrides, err := project.GetOverrides(m.ProjectDir)
+	if err != nil {
+		return err
+	}
+	if _, ok := overrides.Develop[name]; !ok {
+		return fmt.Errorf("'%s' is not overridden", name)
+	}
+	delete(overrides.Develop, name)
+
+	if err := project.WriteOverrides(m.ProjectDir, overrides); err != nil {
+		return fmt.Errorf("failed to write %s: %w", project.OverridesJson, err)
+	}
+	return nil
+}
+
+// staleOverrides returns the names of overridden dependencies that the project
+// no longer declares, or that are no longer repositories.
+func staleOverrides(proj project.Project, overrides project.Overrides) []string {
+	var stale []string
+	for name := range overrides.Develop {
+		if dep, err := findDependency(proj, name); err != nil || !dep.IsRepository() {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
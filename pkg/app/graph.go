@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gogetty/pkg/project"
+	"gogetty/pkg/resolve"
+	"os"
+	"strings"
+)
+
+// graphNode is the JSON form of a module in the dependency tree.
+type graphNode struct {
+	Name         string              `json:"name"`
+	URL          string              `json:"url,omitempty"`
+	Branch       string              `json:"branch,omitempty"`
+	Tag          string              `json:"tag,omitempty"`
+	Commit       string              `json:"commit,omitempty"`
+	Group        string              `json:"group,omitempty"`
+	Directories  []project.Directory `json:"directories,omitempty"`
+	Source       string              `json:"source,omitempty"` // "cache" or "clone"
+	Cycle        bool                `json:"cycle,omitempty"`  // Set instead of repeating the dependencies of a module depending on itself
+	Dependencies []graphNode         `json:"dependencies,omitempty"`
+}
+
+// Graph resolves the project's dependencies and prints the resulting tree as
+// indented text, Graphviz DOT or JSON.
+func (m *MyApp) Graph(ctx context.Context, format string) error {
+	err := ValidateEnvironment()
+	if err != nil {
+		return err
+	}
+	err = validateProject("")
+	if err != nil {
+		return err
+	}
+
+	// Resolve to what fetch locked and linked, rather than to the remotes' newest revisions
+	resolver := &resolve.Resolver{
+		Cache: m.Cache,
+	}
+	if lock, err := project.GetLockFile(m.ProjectDir); err == nil {
+		resolver.Locked = &lock
+	}
+	graph, err := resolver.Resolve(ctx, m.ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "", "text":
+		printGraphText(graph.Root, "", map[*resolve.Node]bool{})
+	case "dot":
+		printGraphDot(graph)
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(graphTree(graph.Root, project.Dependency{}, map[*resolve.Node]bool{}))
+	default:
+		return fmt.Errorf("unknown graph format '%s', expected text, dot or json", format)
+	}
+	return nil
+}
+
+func printGraphText(node *resolve.Node, indent string, ancestors map[*resolve.Node]bool) {
+	if indent == "" {
+		fmt.Println(node.Repo.Name)
+	}
+	ancestors[node] = true
+	defer delete(ancestors, node)
+
+	for _, edge := range node.Edges {
+		child := edge.Node
+		line := fmt.Sprintf("%s    %s %s %s [%s]", indent, edge.Dependency.Name(), child.URL, describeRevision(child), nodeSource(child))
+		if edge.Dependency.Group != "" {
+			line += " group: " + edge.Dependency.Group
+		}
+		if len(edge.Dependency.Directories) > 0 {
+			line += " directories: " + joinDirectories(edge.Dependency.Directories, ", ")
+		}
+		if ancestors[child] {
+			fmt.Println(line + " (cycle)")
+			continue
+		}
+		fmt.Println(line)
+		printGraphText(child, indent+"    ", ancestors)
+	}
+}
+
+func printGraphDot(graph *resolve.Graph) {
+	fmt.Println("digraph gogetty {")
+	fmt.Printf("    %q [shape=box];\n", graph.Root.Repo.Name)
+	for _, node := range graph.Nodes {
+		label := fmt.Sprintf("%s\n%s\n%s", node.Repo.Name, describeRevision(node), nodeSource(node))
+		fmt.Printf("    %q [label=%q, tooltip=%q];\n", node.URL, label, node.URL)
+	}
+
+	parents := append([]*resolve.Node{graph.Root}, graph.Nodes...)
+	for _, parent := range parents {
+		from := parent.URL
+		if parent == graph.Root {
+			from = parent.Repo.Name
+		}
+		for _, edge := range parent.Edges {
+			attrs := ""
+			if len(edge.Dependency.Directories) > 0 {
+				attrs = fmt.Sprintf(" [label=%q]", joinDirectories(edge.Dependency.Directories, "\n"))
+			}
+			fmt.Printf("    %q -> %q%s;\n", from, edge.Node.URL, attrs)
+		}
+	}
+	fmt.Println("}")
+}
+
+func graphTree(node *resolve.Node, dep project.Dependency, ancestors map[*resolve.Node]bool) graphNode {
+	name := node.Repo.Name
+	if node.URL != "" {
+		name = dep.Name()
+	}
+	tree := graphNode{
+		Name:        name,
+		URL:         node.URL,
+		Branch:      node.Repo.Branch,
+		Tag:         node.Tag,
+		Commit:      node.Repo.Commit,
+		Group:       dep.Group,
+		Directories: dep.Directories,
+		Source:      nodeSource(node),
+	}
+	if node.URL == "" {
+		// The project itself isn't a module
+		tree.Source = ""
+	}
+	if ancestors[node] {
+		tree.Cycle = true
+		return tree
+	}
+
+	ancestors[node] = true
+	defer delete(ancestors, node)
+	for _, edge := range node.Edges {
+		tree.Dependencies = append(tree.Dependencies, graphTree(edge.Node, edge.Dependency, ancestors))
+	}
+	return tree
+}
+
+// describeRevision summarizes the branch, tag and commit a module resolved to.
+func describeRevision(node *resolve.Node) string {
+	var parts []string
+	if node.Repo.Branch != "" {
+		parts = append(parts, "branch "+node.Repo.Branch)
+	}
+	if node.Tag != "" {
+		parts = append(parts, "tag "+node.Tag)
+	}
+	if node.Repo.Commit != "" {
+		parts = append(parts, "@ "+shortCommit(node.Repo.Commit))
+	}
+	return strings.Join(parts, " ")
+}
+
+func joinDirectories(dirs []project.Directory, sep string) string {
+	var parts []string
+	for _, dir := range dirs {
+		parts = append(parts, dir.String())
+	}
+	return strings.Join(parts, sep)
+}
+
+func nodeSource(node *resolve.Node) string {
+	if node.Cached {
+		return "cache"
+	}
+	return "clone"
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
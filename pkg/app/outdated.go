@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/project"
+	"gogetty/pkg/semver"
+	"os"
+)
+
+// ErrUnchecked is returned by Outdated when some dependencies couldn't be
+// checked, after the report has been printed.
+var ErrUnchecked = errors.New("some dependencies couldn't be checked")
+
+// outdatedDependency is the JSON form of a dependency in the outdated report.
+type outdatedDependency struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Branch    string `json:"branch,omitempty"`    // Tracked branch, empty for the default branch
+	Version   string `json:"version,omitempty"`   // Version constraint of the manifest
+	Commit    string `json:"commit,omitempty"`    // Commit the lockfile pins
+	Tag       string `json:"tag,omitempty"`       // Tag the lockfile pins, for version constraints
+	Head      string `json:"head,omitempty"`      // Commit at the tip of the tracked branch upstream
+	LatestTag string `json:"latestTag,omitempty"` // Newest release tag upstream
+	WantedTag string `json:"wantedTag,omitempty"` // Newest tag the version constraint allows
+	Behind    *int   `json:"behind,omitempty"`    // Commits between the pinned commit and the head, unless the head doesn't descend from it
+	Outdated  bool   `json:"outdated"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Outdated asks the remote of every dependency in the manifest for the tip of
+// its branch and its newest tags, and prints how they compare to what the
+// lockfile pins, as text or JSON. Nothing is changed.
+func (m *MyApp) Outdated(ctx context.Context, format string) error {
+	if format != "" && format != "text" && format != "json" {
+		return fmt.Errorf("unknown outdated format '%s', expected text or json", format)
+	}
+	err := ValidateEnvironment()
+	if err != nil {
+		return err
+	}
+	err = validateProject("")
+	if err != nil {
+		return err
+	}
+
+	proj, err := project.GetProjectFile(m.ProjectDir)
+	if err != nil {
+		return err
+	}
+	lock, err := project.GetLockFile(m.ProjectDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	reports := []outdatedDependency{}
+	outdated, unchecked := 0, 0
+	for _, dep := range proj.Dependencies {
+		// Local dependencies and archives have no upstream to compare with
+		if !dep.IsRepository() {
+			continue
+		}
+		report := m.checkOutdated(ctx, dep, lock)
+		if report.Error != "" {
+			unchecked++
+		} else if report.Outdated {
+			outdated++
+		}
+		reports = append(reports, report)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(struct {
+			UpToDate     bool                 `json:"upToDate"`
+			Dependencies []outdatedDependency `json:"dependencies"`
+		}{outdated == 0 && unchecked == 0, reports})
+		if err != nil {
+			return err
+		}
+	} else {
+		printOutdated(reports, outdated, unchecked)
+	}
+
+	if unchecked > 0 {
+		return ErrUnchecked
+	}
+	return nil
+}
+
+func (m *MyApp) checkOutdated(ctx context.Context, dep project.Dependency, lock project.Lock) outdatedDependency {
+	report := outdatedDependency{
+		Name:    dep.Name(),
+		URL:     dep.Repository.URL,
+		Branch:  dep.Repository.Branch,
+		Version: dep.Version,
+	}
+	locked := lock.Find(dep.Repository.URL)
+	if locked == nil || !locked.Direct {
+		report.Error = fmt.Sprintf("not in %s, run 'gogetty fetch'", project.LockJson)
+		return report
+	}
+	report.Commit = locked.Commit
+	report.Tag = locked.Version
+
+	remote, err := gitop.QueryRemote(ctx, dep.Repository.URL, dep.Mirrors)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if head, ok := remote.Tip(dep.Repository.Branch); ok {
+		report.Head = head
+	}
+	if latest, ok := gitop.LatestVersion(remote.Tags); ok {
+		report.LatestTag = latest.Name
+	}
+
+	if dep.Version != "" {
+		constraint, err := semver.ParseConstraint(dep.Version)
+		if err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		if wanted, err := gitop.MatchVersion(constraint, remote.Tags); err == nil {
+			report.WantedTag = wanted.Name
+		}
+		report.Outdated = newerTag(report.LatestTag, report.Tag)
+		return report
+	}
+
+	if report.Head == "" {
+		report.Error = fmt.Sprintf("branch '%s' not found upstream", dep.Repository.Branch)
+		return report
+	}
+	if report.Head != report.Commit {
+		report.Outdated = true
+		report.Behind = commitsBehind(ctx, dep, locked, report.Head)
+	}
+	return report
+}
+
+// commitsBehind counts the commits between the pinned commit and head, cloning
+// just the history of the branch for it like upgrade does for its log. Cached
+// clones are shallow, so they rarely have that history.
+func commitsBehind(ctx context.Context, dep project.Dependency, locked *project.LockedModule, head string) *int {
+	commits, err := gitop.FetchLog(ctx, dep.Repository.URL, dep.Mirrors, dep.Repository.Branch, locked.Commit, head)
+	if err != nil {
+		return nil
+	}
+	behind := len(commits)
+	return &behind
+}
+
+// newerTag reports whether the version tag latest is above pinned.
+func newerTag(latest, pinned string) bool {
+	l, err := semver.Parse(latest)
+	if err != nil {
+		return false
+	}
+	p, err := semver.Parse(pinned)
+	if err != nil {
+		return true
+	}
+	return semver.Compare(l, p) > 0
+}
+
+func printOutdated(reports []outdatedDependency, outdated, unchecked int) {
+	for _, report := range reports {
+		switch {
+		case report.Error != "":
+			fmt.Printf("%s: %s\n", report.Name, report.Error)
+		case report.Version != "" && report.Outdated:
+			line := fmt.Sprintf("%s: %s (%s), newest tag is %s", report.Name, report.Tag, shortCommit(report.Commit), report.LatestTag)
+			if report.WantedTag != report.LatestTag {
+				line += fmt.Sprintf(", %s allows up to %s", report.Version, orNone(report.WantedTag))
+			}
+			fmt.Println(line)
+		case report.Outdated:
+			branch := report.Branch
+			if branch == "" {
+				branch = "the default branch"
+			}
+			line := fmt.Sprintf("%s: %s, %s is at %s", report.Name, shortCommit(report.Commit), branch, shortCommit(report.Head))
+			if report.Behind != nil {
+				line += fmt.Sprintf(", %d commit(s) behind", *report.Behind)
+			}
+			fmt.Println(line)
+		case report.Tag != "":
+			fmt.Printf("%s: up to date at %s (%s)\n", report.Name, report.Tag, shortCommit(report.Commit))
+		default:
+			fmt.Printf("%s: up to date at %s\n", report.Name, shortCommit(report.Commit))
+		}
+	}
+
+	if unchecked > 0 {
+		fmt.Printf("%d of %d dependencies outdated, %d couldn't be checked\n", outdated, len(reports), unchecked)
+	} else if outdated > 0 {
+		fmt.Printf("%d of %d dependencies outdated\n", outdated, len(reports))
+	} else {
+		fmt.Printf("All %d dependencies up to date\n", len(reports))
+	}
+}
+
+func orNone(tag string) string {
+	if tag == "" {
+		return "none"
+	}
+	return tag
+}
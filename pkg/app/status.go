@@ -0,0 +1,296 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gogetty/pkg/archive"
+	"gogetty/pkg/cache"
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/project"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutOfSync is returned by Status when the project doesn't match its lockfile,
+// after the report has been printed.
+var ErrOutOfSync = errors.New("project is out of sync")
+
+// dependencyStatus is the JSON form of a dependency in the status report.
+type dependencyStatus struct {
+	Name     string       `json:"name"`
+	URL      string       `json:"url,omitempty"`
+	Direct   bool         `json:"direct"`
+	Local    bool         `json:"local,omitempty"`    // Linked from a local directory, never locked
+	Archive  bool         `json:"archive,omitempty"`  // Extracted from an archive, pinned by its checksum rather than locked
+	Override string       `json:"override,omitempty"` // Working copy linked in place of the cache clone, see 'gogetty develop'
+	Path     string       `json:"path,omitempty"`     // Cache clone the lockfile records, the local directory or the extracted archive
+	Commit   string       `json:"commit,omitempty"`   // Commit the lockfile pins
+	Head     string       `json:"head,omitempty"`     // Commit checked out in the cache clone
+	Cached   bool         `json:"cached"`
+	Modified []string     `json:"modified,omitempty"` // Tracked files changed in the cache clone
+	Links    []linkStatus `json:"links,omitempty"`
+	Problems []string     `json:"problems,omitempty"`
+	InSync   bool         `json:"inSync"`
+}
+
+type linkStatus struct {
+	Path   string `json:"path"`             // Relative to the project
+	Target string `json:"target"`           // Where the link should point
+	Actual string `json:"actual,omitempty"` // Where it points, when it is a link
+	OK     bool   `json:"ok"`
+}
+
+// Status compares the manifest, the lockfile, the cache clones and the links in
+// the project, and prints whether each dependency is in sync as text or JSON.
+// Dependencies the groups leave out aren't expected to be linked.
+func (m *MyApp) Status(format string, groups project.GroupFilter) error {
+	if format != "" && format != "text" && format != "json" {
+		return fmt.Errorf("unknown status format '%s', expected text or json", format)
+	}
+	err := ValidateEnvironment()
+	if err != nil {
+		return err
+	}
+	err = validateProject("")
+	if err != nil {
+		return err
+	}
+
+	proj, err := project.GetProjectFile(m.ProjectDir)
+	if err != nil {
+		return err
+	}
+	lock, err := project.GetLockFile(m.ProjectDir)
+	locked := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	overrides, err := project.GetOverrides(m.ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	var statuses []dependencyStatus
+	for _, dep := range proj.Dependencies {
+		if dep.IsLocal() {
+			statuses = append(statuses, finishStatus(m.localStatus(proj, dep, groups)))
+			continue
+		}
+		if dep.IsArchive() {
+			statuses = append(statuses, finishStatus(m.archiveStatus(proj, dep, groups)))
+			continue
+		}
+
+		status := dependencyStatus{Name: dep.Name(), URL: dep.Repository.URL, Direct: true}
+		if !locked {
+			status.Problems = append(status.Problems, fmt.Sprintf("not in %s, run 'gogetty fetch'", project.LockJson))
+		} else if err := project.VerifyDependency(dep, lock); err != nil {
+			status.Problems = append(status.Problems, err.Error()+", run 'gogetty fetch'")
+		}
+		if mod := lock.Find(dep.Repository.URL); mod != nil && mod.Direct {
+			checkClone(&status, *mod)
+		}
+		// An override is never in sync, so that nobody ships with one by accident
+		if dir, ok := overrides.Dir(m.ProjectDir, dep.Name()); ok {
+			status.Override = dir
+			status.Problems = append(status.Problems, fmt.Sprintf("overridden by the working copy at %s, run 'gogetty undevelop %s'", dir, dep.Name()))
+			if groups.Includes(dep) {
+				checkLinks(&status, m.ProjectDir, proj.ModulesDir, dir, dep)
+			}
+		} else if status.Cached && groups.Includes(dep) {
+			checkLinks(&status, m.ProjectDir, proj.ModulesDir, status.Path, dep)
+		}
+		statuses = append(statuses, finishStatus(status))
+	}
+
+	for _, name := range staleOverrides(proj, overrides) {
+		status := dependencyStatus{Name: name, Override: overrides.Develop[name]}
+		status.Problems = append(status.Problems, fmt.Sprintf("overridden in %s but not a dependency of the project, run 'gogetty undevelop %s'", project.OverridesJson, name))
+		statuses = append(statuses, finishStatus(status))
+	}
+
+	for _, mod := range project.Undeclared(proj, lock) {
+		status := dependencyStatus{Name: mod.Name, URL: mod.URL, Direct: true}
+		status.Problems = append(status.Problems, fmt.Sprintf("locked but no longer in %s, run 'gogetty fetch'", project.ProjectJson))
+		statuses = append(statuses, finishStatus(status))
+	}
+
+	for _, mod := range lock.Modules {
+		if mod.Direct {
+			continue
+		}
+		status := dependencyStatus{Name: mod.Name, URL: mod.URL}
+		checkClone(&status, mod)
+		statuses = append(statuses, finishStatus(status))
+	}
+
+	outOfSync := 0
+	for _, status := range statuses {
+		if !status.InSync {
+			outOfSync++
+		}
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		report := struct {
+			InSync       bool               `json:"inSync"`
+			Dependencies []dependencyStatus `json:"dependencies"`
+		}{outOfSync == 0, statuses}
+		if report.Dependencies == nil {
+			report.Dependencies = []dependencyStatus{}
+		}
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printStatus(statuses, outOfSync)
+	}
+
+	if outOfSync > 0 {
+		return ErrOutOfSync
+	}
+	return nil
+}
+
+// checkClone checks that the cache clone of a locked module exists, has the
+// locked commit checked out and hasn't been edited.
+func checkClone(status *dependencyStatus, mod project.LockedModule) {
+	repoDir := filepath.Join(cache.ModuleDir(), filepath.FromSlash(mod.Path))
+	status.Path = repoDir
+	status.Commit = mod.Commit
+
+	if _, err := os.Stat(repoDir); err != nil {
+		status.Problems = append(status.Problems, "not in the cache, run 'gogetty fetch'")
+		return
+	}
+	status.Cached = true
+
+	head, err := gitop.ResolveHead(repoDir)
+	if err != nil {
+		status.Problems = append(status.Problems, err.Error())
+		return
+	}
+	status.Head = head
+	if head != mod.Commit {
+		status.Problems = append(status.Problems, fmt.Sprintf("HEAD is at %s but %s pins %s", shortCommit(head), project.LockJson, shortCommit(mod.Commit)))
+	}
+
+	modified, err := gitop.ModifiedFiles(repoDir)
+	if err != nil {
+		status.Problems = append(status.Problems, err.Error())
+		return
+	}
+	status.Modified = modified
+	if len(modified) > 0 {
+		status.Problems = append(status.Problems, fmt.Sprintf("%d file(s) modified in the cache: %s", len(modified), strings.Join(modified, ", ")))
+	}
+}
+
+// localStatus checks that the directory of a local dependency exists, and that
+// the project links to it.
+func (m *MyApp) localStatus(proj project.Project, dep project.Dependency, groups project.GroupFilter) dependencyStatus {
+	status := dependencyStatus{Name: dep.Name(), Direct: true, Local: true, Path: dep.LocalDir(m.ProjectDir)}
+	if info, err := os.Stat(status.Path); err != nil || !info.IsDir() {
+		status.Problems = append(status.Problems, fmt.Sprintf("local directory %s not found", status.Path))
+		return status
+	}
+	if groups.Includes(dep) {
+		checkLinks(&status, m.ProjectDir, proj.ModulesDir, status.Path, dep)
+	}
+	return status
+}
+
+// archiveStatus checks that an archive is extracted in the cache, and that the
+// project links to it.
+func (m *MyApp) archiveStatus(proj project.Project, dep project.Dependency, groups project.GroupFilter) dependencyStatus {
+	status := dependencyStatus{Name: dep.Name(), URL: dep.Archive.URL, Direct: true, Archive: true, Path: archive.Dir(dep.Archive.SHA256)}
+	if _, err := os.Stat(status.Path); err != nil {
+		status.Problems = append(status.Problems, "not in the cache, run 'gogetty fetch'")
+		return status
+	}
+	status.Cached = true
+
+	source, err := archiveSource(status.Path, *dep.Archive)
+	if err != nil {
+		status.Problems = append(status.Problems, err.Error())
+		return status
+	}
+	if groups.Includes(dep) {
+		checkLinks(&status, m.ProjectDir, proj.ModulesDir, source, dep)
+	}
+	return status
+}
+
+// checkLinks checks the links fetch makes in the project for a direct
+// dependency whose files are in source, see linkDirectories.
+func checkLinks(status *dependencyStatus, projectDir, modulesDir, source string, dep project.Dependency) {
+	targetDir := filepath.Join(modulesDir, dep.Name())
+
+	links := map[string]string{}
+	var order []string
+	addLink := func(link, target string) {
+		order = append(order, link)
+		links[link] = target
+	}
+	if len(dep.Directories) == 0 {
+		addLink(targetDir, source)
+	}
+	for _, dir := range dep.Directories {
+		from := filepath.Join(source, filepath.FromSlash(dir.From))
+		if dir.To == "" {
+			addLink(filepath.Join(targetDir, filepath.FromSlash(dir.From)), from)
+		} else {
+			addLink(filepath.FromSlash(dir.To), from)
+		}
+	}
+
+	for _, link := range order {
+		check := linkStatus{Path: filepath.ToSlash(link), Target: links[link]}
+		actual, err := os.Readlink(filepath.Join(projectDir, link))
+		switch {
+		case os.IsNotExist(err):
+			status.Problems = append(status.Problems, fmt.Sprintf("link %s is missing, run 'gogetty fetch'", check.Path))
+		case err != nil:
+			status.Problems = append(status.Problems, fmt.Sprintf("%s is not a link", check.Path))
+		case filepath.Clean(actual) != filepath.Clean(check.Target):
+			check.Actual = actual
+			status.Problems = append(status.Problems, fmt.Sprintf("link %s points at %s instead of %s", check.Path, actual, check.Target))
+		default:
+			check.Actual = actual
+			check.OK = true
+		}
+		status.Links = append(status.Links, check)
+	}
+}
+
+func finishStatus(status dependencyStatus) dependencyStatus {
+	status.InSync = len(status.Problems) == 0
+	return status
+}
+
+func printStatus(statuses []dependencyStatus, outOfSync int) {
+	for _, status := range statuses {
+		if status.InSync && status.Local {
+			fmt.Printf("%s: in sync, local at %s\n", status.Name, status.Path)
+			continue
+		}
+		if status.InSync {
+			fmt.Printf("%s: in sync\n", status.Name)
+			continue
+		}
+		for _, problem := range status.Problems {
+			fmt.Printf("%s: %s\n", status.Name, problem)
+		}
+	}
+
+	if outOfSync > 0 {
+		fmt.Printf("%d of %d dependencies out of sync\n", outOfSync, len(statuses))
+	} else {
+		fmt.Printf("All %d dependencies in sync\n", len(statuses))
+	}
+}
@@ -0,0 +1,202 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/project"
+	"gogetty/pkg/semver"
+	"os"
+)
+
+// upgradePlan is a dependency moving from the commit the lockfile pins to the
+// newest one its manifest entry allows.
+type upgradePlan struct {
+	Dependency project.Dependency
+	Ref        string // Branch or tag whose history holds the new commit, empty for the default branch
+	From       string
+	FromTag    string
+	To         string
+	ToTag      string
+}
+
+// Upgrade moves dependencies to the newest revision their manifest entries allow:
+// the highest tag satisfying their version constraint, or else the tip of their
+// branch. Commits pinned in the manifest are rewritten, the project is fetched
+// again, and the log of every upgraded dependency is printed for review.
+func (m *MyApp) Upgrade(ctx context.Context, names []string, all bool, opts FetchOptions) error {
+	err := ValidateEnvironment()
+	if err != nil {
+		return err
+	}
+	err = validateProject("")
+	if err != nil {
+		return err
+	}
+	if all && len(names) > 0 {
+		return fmt.Errorf("either name the dependencies to upgrade or pass --all, not both")
+	}
+	if !all && len(names) == 0 {
+		return fmt.Errorf("name the dependencies to upgrade, or pass --all")
+	}
+
+	proj, err := project.GetProjectFile(m.ProjectDir)
+	if err != nil {
+		return err
+	}
+	lock, err := project.GetLockFile(m.ProjectDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var deps []project.Dependency
+	if all {
+		for _, dep := range proj.Dependencies {
+			if dep.IsRepository() {
+				deps = append(deps, dep)
+			}
+		}
+	}
+	for _, name := range names {
+		dep, err := findDependency(proj, name)
+		if err != nil {
+			return err
+		}
+		if !dep.IsRepository() {
+			return fmt.Errorf("'%s' isn't a git repository, it has nothing to upgrade", name)
+		}
+		deps = append(deps, dep)
+	}
+
+	var plans []upgradePlan
+	var pinned []upgradePlan // Upgrades of commits pinned in the manifest
+	upgrades := map[string]string{}
+	for _, dep := range deps {
+		plan, err := planUpgrade(ctx, dep, lock)
+		if err != nil {
+			return err
+		}
+		if plan.From != "" && gitop.SameCommit(plan.From, plan.To) {
+			fmt.Printf("%s: already up to date at %s\n", dep.Name(), describeCommit(plan.To, plan.ToTag))
+			continue
+		}
+
+		// Constraints select the newest tag they allow once the locked one is let go of
+		if dep.Version == "" && dep.Repository.Commit != "" {
+			pinned = append(pinned, plan)
+		} else {
+			upgrades[gitop.NormalizeURL(dep.Repository.URL)] = plan.To
+		}
+		plans = append(plans, plan)
+	}
+	if len(plans) == 0 {
+		return nil
+	}
+
+	// Fetch reads the manifest, so the new pins are written first and put back
+	// when the fetch fails, rather than leaving the manifest half upgraded
+	var written []upgradePlan
+	restore := func() {
+		for _, plan := range written {
+			if err := project.UpdateDependency(plan.upgraded(), plan.Dependency); err != nil {
+				fmt.Printf("Error restoring %s in %s: %v\n", plan.Dependency.Name(), project.ProjectJson, err)
+			}
+		}
+	}
+	for _, plan := range pinned {
+		if err := project.UpdateDependency(plan.Dependency, plan.upgraded()); err != nil {
+			restore()
+			return err
+		}
+		written = append(written, plan)
+	}
+
+	opts.Upgrades = upgrades
+	if err := m.Fetch(ctx, opts); err != nil {
+		restore()
+		return err
+	}
+
+	for _, plan := range plans {
+		printUpgrade(ctx, plan)
+	}
+	return nil
+}
+
+// upgraded returns the manifest entry of a dependency pinned to a commit, moved
+// to the new one.
+func (p upgradePlan) upgraded() project.Dependency {
+	dep := p.Dependency
+	dep.Repository.Commit = p.To
+	return dep
+}
+
+func findDependency(proj project.Project, name string) (project.Dependency, error) {
+	for _, dep := range proj.Dependencies {
+		if dep.Name() == name {
+			return dep, nil
+		}
+	}
+	return project.Dependency{}, fmt.Errorf("dependency '%s' not found in %s", name, project.ProjectJson)
+}
+
+// planUpgrade asks the remote of a dependency for the newest revision its
+// manifest entry allows.
+func planUpgrade(ctx context.Context, dep project.Dependency, lock project.Lock) (upgradePlan, error) {
+	plan := upgradePlan{Dependency: dep, From: dep.Repository.Commit}
+	if locked := lock.Find(dep.Repository.URL); locked != nil && locked.Direct {
+		plan.From, plan.FromTag = locked.Commit, locked.Version
+	}
+
+	remote, err := gitop.QueryRemote(ctx, dep.Repository.URL, dep.Mirrors)
+	if err != nil {
+		return plan, err
+	}
+
+	if dep.Version != "" {
+		constraint, err := semver.ParseConstraint(dep.Version)
+		if err != nil {
+			return plan, fmt.Errorf("%s: %v", dep.Name(), err)
+		}
+		tag, err := gitop.MatchVersion(constraint, remote.Tags)
+		if err != nil {
+			return plan, fmt.Errorf("%s: %v", dep.Name(), err)
+		}
+		plan.Ref, plan.To, plan.ToTag = tag.Name, tag.Commit, tag.Name
+		return plan, nil
+	}
+
+	tip, ok := remote.Tip(dep.Repository.Branch)
+	if !ok {
+		return plan, fmt.Errorf("%s: branch '%s' not found in %s", dep.Name(), dep.Repository.Branch, dep.Repository.URL)
+	}
+	plan.Ref, plan.To = dep.Repository.Branch, tip
+	return plan, nil
+}
+
+// printUpgrade shows the commits a dependency moved past. Downgrades and
+// rewritten histories have no log to show.
+func printUpgrade(ctx context.Context, plan upgradePlan) {
+	dep := plan.Dependency
+	if plan.From == "" {
+		fmt.Printf("%s: now at %s\n", dep.Name(), describeCommit(plan.To, plan.ToTag))
+		return
+	}
+	fmt.Printf("%s: %s -> %s\n", dep.Name(), describeCommit(plan.From, plan.FromTag), describeCommit(plan.To, plan.ToTag))
+
+	commits, err := gitop.FetchLog(ctx, dep.Repository.URL, dep.Mirrors, plan.Ref, plan.From, plan.To)
+	if err != nil {
+		fmt.Printf("    The log isn't available: %v\n", err)
+		return
+	}
+	for _, commit := range commits {
+		fmt.Printf("    %s %s (%s)\n", shortCommit(commit.Hash), commit.Subject, commit.Author)
+	}
+}
+
+func describeCommit(commit, tag string) string {
+	if tag != "" {
+		return fmt.Sprintf("%s (%s)", tag, shortCommit(commit))
+	}
+	return shortCommit(commit)
+}
@@ -2,73 +2,183 @@ package app
 
 import (
 	"fmt"
-	"gogetty/pkg/cache"
 	"gogetty/pkg/gitop"
+	"gogetty/pkg/progress"
 	"gogetty/pkg/project"
+	"gogetty/pkg/resolve"
 	"gogetty/pkg/symlink"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
-func fetchRecursive(projectDir string, modules []gitop.GitRepo) error {
-	err := project.Validate(projectDir)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		} else {
-			return nil
+// linkGraph links the modules of a resolved graph into the modules directory of
+// every manifest that declares them, the project's own and those of its modules.
+// Direct dependencies with an override are linked from their working copy instead.
+// It returns the mapped links created in the project, relative to it.
+func linkGraph(graph *resolve.Graph, projectDir string, overrides project.Overrides, prog *progress.Progress) ([]string, error) {
+	var allErrors []error
+	var projectLinks []string
+	failed := map[*resolve.Node]bool{}
+
+	parents := append([]*resolve.Node{graph.Root}, graph.Nodes...)
+	for _, parent := range parents {
+		for _, edge := range parent.Edges {
+			prog.Update(gitop.NormalizeURL(edge.Node.URL), edge.Node.Name(), progress.Linking)
+			var links []string
+			var err error
+			if dir, ok := overrides.Dir(projectDir, edge.Dependency.Name()); ok && parent == graph.Root {
+				if info, statErr := os.Stat(dir); statErr != nil || !info.IsDir() {
+					err = fmt.Errorf("working copy %s not found", dir)
+				} else {
+					links, err = linkDirectories(dir, dir, parent.Repo.Path, parent.ModulesDir, edge.Dependency)
+				}
+			} else {
+				links, err = linkDependency(parent, edge)
+			}
+			if err != nil {
+				prog.Update(gitop.NormalizeURL(edge.Node.URL), edge.Node.Name(), progress.Failed)
+				failed[edge.Node] = true
+				allErrors = append(allErrors, fmt.Errorf("error linking %s: %v", edge.Dependency.Name(), err))
+			}
+			if parent == graph.Root {
+				projectLinks = append(projectLinks, links...)
+			}
 		}
 	}
 
-	proj, err := project.GetProjectFile(projectDir)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		} else {
-			return nil
+	// A module is linked into every manifest declaring it before it is done
+	for _, node := range graph.Nodes {
+		if !failed[node] {
+			prog.Update(gitop.NormalizeURL(node.URL), node.Name(), progress.Done)
 		}
 	}
 
+	if len(allErrors) > 0 {
+		return projectLinks, fmt.Errorf("multiple errors occurred: %v", allErrors)
+	}
+
+	return projectLinks, nil
+}
+
+// linkDependency links a dependency, or its selected directories, into the
+// directory of the manifest declaring it. Mapped directories are linked at their
+// target and returned, relative to that directory.
+func linkDependency(parent *resolve.Node, edge resolve.Edge) ([]string, error) {
+	return linkDirectories(edge.Node.Repo.Path, edge.Node.URL, parent.Repo.Path, parent.ModulesDir, edge.Dependency)
+}
+
+// linkLocal links the local dependencies and archives of the project that the
+// groups select straight from their directories, as linkDependency does for
+// modules. archives holds the directories of the archives fetchArchives extracted;
+// those it failed to fetch are left out. It returns the mapped links created in
+// the project, relative to it.
+func linkLocal(projectDir string, proj project.Project, groups project.GroupFilter, archives map[string]string, prog *progress.Progress) ([]string, error) {
 	var allErrors []error
+	var projectLinks []string
 
 	for _, dep := range proj.Dependencies {
-		repo := gitop.Find(dep.Repository, modules)
-		if repo == nil {
-			repo, err = gitop.Fetch(cache.ModuleDir(), dep.Repository.URL, dep.Repository.Branch, dep.Repository.Commit)
-			if err != nil {
-				if !os.IsNotExist(err) {
-					allErrors = append(allErrors, err)
-				}
+		if dep.IsRepository() || !groups.Includes(dep) {
+			continue
+		}
+		source := dep.LocalDir(projectDir)
+		origin := source
+		if dep.IsArchive() {
+			var ok bool
+			if source, ok = archives[dep.Name()]; !ok {
 				continue
 			}
-
-			if err = fetchRecursive(repo.Path, modules); err != nil {
-				allErrors = append(allErrors, err)
-			}
+			origin = dep.Archive.URL
 		}
-
-		targetDir := filepath.Join(projectDir, proj.ModulesDir, repo.Name)
-		if err := ensureDir(targetDir); err != nil {
-			allErrors = append(allErrors, fmt.Errorf("error creating directory %s: %v", targetDir, err))
+		prog.Update(dep.Source(), dep.Name(), progress.Linking)
+		if info, err := os.Stat(source); err != nil || !info.IsDir() {
+			prog.Update(dep.Source(), dep.Name(), progress.Failed)
+			allErrors = append(allErrors, fmt.Errorf("error linking %s: local directory %s not found", dep.Name(), source))
 			continue
 		}
-		if len(dep.Directories) > 0 {
-			symlink.CreateSymlinkBundle(repo.Path, targetDir, dep.Directories)
+		links, err := linkDirectories(source, origin, projectDir, proj.ModulesDir, dep)
+		if err != nil {
+			prog.Update(dep.Source(), dep.Name(), progress.Failed)
+			allErrors = append(allErrors, fmt.Errorf("error linking %s: %v", dep.Name(), err))
 		} else {
-			symlink.CreateSymlink(repo.Path, targetDir)
-		}
-		new_dep := project.Dependency{
-			Repository:  *repo,
-			Directories: dep.Directories,
+			prog.Update(dep.Source(), dep.Name(), progress.Done)
 		}
-		project.UpdateDependency(dep, new_dep)
+		projectLinks = append(projectLinks, links...)
 	}
 
 	if len(allErrors) > 0 {
-		return fmt.Errorf("multiple errors occurred: %v", allErrors)
+		return projectLinks, fmt.Errorf("multiple errors occurred: %v", allErrors)
 	}
 
-	return nil
+	return projectLinks, nil
+}
+
+// linkDirectories links source, or the directories a dependency selects from it,
+// into the modules directory of the manifest in manifestDir. Mapped directories are
+// linked at their target and returned, relative to manifestDir. origin names the
+// source in errors.
+func linkDirectories(source, origin, manifestDir, modulesDir string, dep project.Dependency) ([]string, error) {
+	targetDir := filepath.Join(manifestDir, modulesDir, dep.Name())
+	if len(dep.Directories) == 0 {
+		return nil, symlink.CreateSymlink(source, targetDir)
+	}
+
+	var plain []string
+	var links []string
+	for _, dir := range dep.Directories {
+		if err := dir.Validate(); err != nil {
+			return links, err
+		}
+		from := filepath.Join(source, filepath.FromSlash(dir.From))
+		if _, err := os.Stat(from); err != nil {
+			return links, fmt.Errorf("directory '%s' not found in %s", dir.From, origin)
+		}
+		if dir.To == "" {
+			plain = append(plain, dir.From)
+			continue
+		}
+
+		if err := symlink.CreateSymlink(from, filepath.Join(manifestDir, filepath.FromSlash(dir.To))); err != nil {
+			return links, err
+		}
+		links = append(links, path.Clean(filepath.ToSlash(dir.To)))
+	}
+
+	if len(plain) > 0 {
+		if err := ensureDir(targetDir); err != nil {
+			return links, fmt.Errorf("error creating directory %s: %v", targetDir, err)
+		}
+		return links, symlink.CreateSymlinkBundle(source, targetDir, plain)
+	}
+	return links, nil
+}
+
+// unlinkStale removes links a previous fetch created in the project that the
+// current one didn't, along with their .gitignore entries.
+func unlinkStale(projectDir string, previous, current []string, prog *progress.Progress) {
+	keep := map[string]bool{}
+	for _, link := range current {
+		keep[link] = true
+	}
+
+	var stale []string
+	for _, link := range previous {
+		if keep[link] {
+			continue
+		}
+		target := filepath.Join(projectDir, filepath.FromSlash(link))
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				fmt.Fprintf(prog, "Error removing stale link %s: %v\n", link, err)
+			}
+		}
+		stale = append(stale, link)
+	}
+
+	if len(stale) > 0 {
+		gitop.RemoveIgnore(projectDir, stale...)
+	}
 }
 
 // ensureDir checks if a directory exists, and if not, creates it
@@ -79,10 +189,23 @@ func ensureDir(dirName string) error {
 	return nil
 }
 
-func printDependency(dep project.Dependency) {
+// printDependency prints a dependency for list, with the working copy overriding
+// it if there is one.
+func printDependency(dep project.Dependency, override string) {
 	indent := "    "
-	if dep.Repository.Name != "" {
-		fmt.Println(indent+"Name:", dep.Repository.Name)
+	fmt.Println(indent+"Name:", dep.Name())
+	if dep.IsLocal() {
+		fmt.Println(indent+"Path:", dep.Path, "(local)")
+	}
+	if dep.IsArchive() {
+		fmt.Println(indent+"Archive:", dep.Archive.URL)
+		fmt.Println(indent+"SHA-256:", dep.Archive.SHA256)
+		if dep.Archive.StripPrefix != "" {
+			fmt.Println(indent+"Strip prefix:", dep.Archive.StripPrefix)
+		}
+	}
+	if override != "" {
+		fmt.Println(indent+"Override:", override, "(gogetty develop, not shared)")
 	}
 	if dep.Repository.URL != "" {
 		fmt.Println(indent+"Url:", dep.Repository.URL)
@@ -93,11 +216,52 @@ func printDependency(dep project.Dependency) {
 	if dep.Repository.Commit != "" {
 		fmt.Println(indent+"Commit:", dep.Repository.Commit)
 	}
+	if dep.Version != "" {
+		fmt.Println(indent+"Version:", dep.Version)
+	}
+	if dep.Group != "" {
+		fmt.Println(indent+"Group:", dep.Group)
+	}
+	if dep.Submodules {
+		fmt.Println(indent + "Submodules: yes")
+	}
+	if dep.LFS {
+		fmt.Println(indent + "LFS: yes")
+	}
+	if len(dep.Mirrors) > 0 {
+		fmt.Println(indent + "Mirrors: " + strings.Join(dep.Mirrors, ", "))
+	}
 	if len(dep.Directories) > 0 {
 		fmt.Println(indent + "Directories:")
 		for _, dir := range dep.Directories {
-			fmt.Println(indent + indent + dir)
+			fmt.Println(indent + indent + dir.String())
 		}
 	}
 	fmt.Println()
 }
+
+// keepExcluded carries the modules that a fetch with a group filter left out over
+// from the previous lock, so the lock keeps covering every group. Direct modules
+// are only kept while the manifest still declares them.
+func keepExcluded(lock project.Lock, previous *project.Lock, proj project.Project) project.Lock {
+	if previous == nil {
+		return lock
+	}
+	for _, mod := range previous.Modules {
+		if lock.Find(mod.URL) != nil || (mod.Direct && !declares(proj, mod.URL)) {
+			continue
+		}
+		lock.Modules = append(lock.Modules, mod)
+	}
+	return lock
+}
+
+// declares reports whether the manifest declares a repository.
+func declares(proj project.Project, url string) bool {
+	for _, dep := range proj.Dependencies {
+		if dep.IsRepository() && gitop.SameURL(dep.Repository.URL, url) {
+			return true
+		}
+	}
+	return false
+}
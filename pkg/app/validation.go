@@ -3,19 +3,35 @@ package app
 import (
 	"fmt"
 	"gogetty/pkg/cache"
+	"gogetty/pkg/config"
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/project"
 	"os"
-	"os/exec"
 	"path/filepath"
 )
 
 func ValidateEnvironment() error {
 
-	// Check if git is installed
-	if err := checkGitInstalled(); err != nil {
-		fmt.Println("Error: Git is required but not found:", err)
-		fmt.Println("Please install Git to use this application. Visit https://git-scm.com for installation instructions.")
-		os.Exit(1)
+	// Select the git backend, the go backend works without git installed
+	cfg, err := config.Load()
+	if err != nil {
+		return err
 	}
+	if err := gitop.UseBackend(cfg.GitBackend); err != nil {
+		return fmt.Errorf("%v (the backend is set by \"gitBackend\" in %s or %s)", err, config.Path(), config.GitBackendEnv)
+	}
+	if err := gitop.UseCredentials(cfg.Credentials); err != nil {
+		return fmt.Errorf("%v (in %s)", err, config.Path())
+	}
+	if err := gitop.UseRewrites(cfg.URLRewrites); err != nil {
+		return fmt.Errorf("%v (in %s)", err, config.Path())
+	}
+	gitop.UseOffline(cfg.Offline)
+	network, err := cfg.Network.Options()
+	if err != nil {
+		return fmt.Errorf("%v (in %s)", err, config.Path())
+	}
+	gitop.UseNetwork(network)
 
 	// Check if the cache is initialized
 	if err := checkCacheInitialized(); err != nil {
@@ -28,9 +44,13 @@ func ValidateEnvironment() error {
 	return nil
 }
 
-func checkGitInstalled() error {
-	_, err := exec.LookPath("git")
-	return err
+// validateProject checks that projectDir holds a manifest, upgrading it to the
+// current schema version if it was written by an older gogetty.
+func validateProject(projectDir string) error {
+	if err := project.Validate(projectDir); err != nil {
+		return err
+	}
+	return project.Migrate(projectDir)
 }
 
 func checkCacheInitialized() error {
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"fmt"
+	"gogetty/pkg/cache"
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/project"
+	"os"
+	"path/filepath"
+)
+
+// Verify checks every locked module in the cache, printing each problem found.
+func (m *MyApp) Verify() error {
+	err := ValidateEnvironment()
+	if err != nil {
+		return err
+	}
+	err = validateProject("")
+	if err != nil {
+		return err
+	}
+
+	lock, err := project.GetLockFile(m.ProjectDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s not found, run 'gogetty fetch' to create it", project.LockJson)
+		}
+		return err
+	}
+
+	problems := 0
+	for _, mod := range lock.Modules {
+		for _, problem := range verifyModule(mod) {
+			fmt.Printf("%s: %s\n", mod.Name, problem)
+			problems++
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problem(s) in %d module(s)", problems, len(lock.Modules))
+	}
+	fmt.Printf("All %d module(s) verified\n", len(lock.Modules))
+	return nil
+}
+
+func verifyModule(mod project.LockedModule) []string {
+	var problems []string
+	repoDir := filepath.Join(cache.ModuleDir(), filepath.FromSlash(mod.Path))
+
+	if _, err := os.Stat(repoDir); err != nil {
+		return []string{"not in the cache, run 'gogetty fetch'"}
+	}
+	if checksum, err := gitop.TreeHash(repoDir); err != nil {
+		problems = append(problems, err.Error())
+	} else if checksum != mod.Checksum {
+		problems = append(problems, fmt.Sprintf("checksum mismatch, locked %s, found %s", mod.Checksum, checksum))
+	}
+
+	pointers, err := gitop.FindLFSPointers(repoDir)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, pointer := range pointers {
+		problems = append(problems, fmt.Sprintf("%s is a Git LFS pointer, fetch the dependency with \"lfs\": true", pointer))
+	}
+
+	submodules, err := gitop.FindEmptySubmodules(repoDir)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, submodule := range submodules {
+		problems = append(problems, fmt.Sprintf("submodule %s is empty, fetch the dependency with \"submodules\": true", submodule))
+	}
+
+	return problems
+}
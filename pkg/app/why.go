@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"gogetty/pkg/project"
+	"gogetty/pkg/resolve"
+	"strings"
+)
+
+// Why prints every chain of manifests leading from the project to the named
+// dependency, along with the revision each step declared.
+func (m *MyApp) Why(ctx context.Context, name string) error {
+	err := ValidateEnvironment()
+	if err != nil {
+		return err
+	}
+	err = validateProject("")
+	if err != nil {
+		return err
+	}
+
+	// Local dependencies and archives are linked by the project alone, outside of the graph
+	proj, err := project.GetProjectFile(m.ProjectDir)
+	if err != nil {
+		return err
+	}
+	if dep, err := findDependency(proj, name); err == nil && dep.IsLocal() {
+		fmt.Printf("%s is a local dependency of this project, linked from %s\n", name, dep.LocalDir(m.ProjectDir))
+		return nil
+	} else if err == nil && dep.IsArchive() {
+		fmt.Printf("%s is an archive dependency of this project, downloaded from %s\n", name, dep.Archive.URL)
+		return nil
+	}
+
+	// Resolve to what fetch locked and linked, rather than to the remotes' newest revisions
+	resolver := &resolve.Resolver{
+		Cache: m.Cache,
+	}
+	if lock, err := project.GetLockFile(m.ProjectDir); err == nil {
+		resolver.Locked = &lock
+	}
+	graph, err := resolver.Resolve(ctx, m.ProjectDir)
+	if err != nil {
+		return err
+	}
+
+	paths := findPaths(graph.Root, name, nil, map[*resolve.Node]bool{})
+	if len(paths) == 0 {
+		return fmt.Errorf("%s is not a dependency of this project", name)
+	}
+
+	fmt.Printf("%s is required by %d path(s):\n", name, len(paths))
+	for _, path := range paths {
+		steps := []string{graph.Root.Repo.Name}
+		for _, edge := range path {
+			steps = append(steps, fmt.Sprintf("%s (%s)", edge.Dependency.Name(), resolve.Constraint(edge.Dependency)))
+		}
+		fmt.Println("    " + strings.Join(steps, " -> "))
+	}
+	return nil
+}
+
+// findPaths returns the edges of every acyclic path from node to the named module.
+func findPaths(node *resolve.Node, name string, path []resolve.Edge, ancestors map[*resolve.Node]bool) [][]resolve.Edge {
+	ancestors[node] = true
+	defer delete(ancestors, node)
+
+	var paths [][]resolve.Edge
+	for _, edge := range node.Edges {
+		if ancestors[edge.Node] {
+			continue
+		}
+		next := append(append([]resolve.Edge{}, path...), edge)
+		if edge.Dependency.Name() == name || edge.Node.Repo.Name == name {
+			paths = append(paths, next)
+			continue
+		}
+		paths = append(paths, findPaths(edge.Node, name, next, ancestors)...)
+	}
+	return paths
+}
@@ -0,0 +1,383 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gogetty/pkg/cache"
+	"gogetty/pkg/gitop"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// tmpPrefix starts the names of downloads and extractions still being written to
+// the cache, like the clones gitop.RemoveStaleClones cleans up.
+const tmpPrefix = ".tmp-"
+
+// Dir returns the cache directory an archive with the given SHA-256 is extracted to.
+func Dir(sum string) string {
+	return filepath.Join(cache.ArchiveDir(), strings.ToLower(sum))
+}
+
+// Name derives the name of a dependency from the URL of its archive: the file
+// name without its extension.
+func Name(archiveURL string) string {
+	name := archiveURL
+	if u, err := url.Parse(archiveURL); err == nil {
+		name = u.Path
+	}
+	name = path.Base(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// Fetch downloads an archive, checks it against its SHA-256 and extracts it into
+// the cache, unless it is there already. It returns the directory it was
+// extracted to. Nothing is extracted from an archive that doesn't match.
+func Fetch(ctx context.Context, archiveURL, sum string) (string, error) {
+	dir := Dir(sum)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+	if gitop.Offline() {
+		return "", fmt.Errorf("%w, %s can't be reached", gitop.ErrOffline, archiveURL)
+	}
+	if err := os.MkdirAll(cache.ArchiveDir(), 0755); err != nil {
+		return "", err
+	}
+
+	// Everything is written to one temporary directory, left for 'gogetty clean'
+	// to remove if the fetch is killed
+	tmpDir, err := os.MkdirTemp(cache.ArchiveDir(), tmpPrefix+strings.ToLower(sum)+"-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	file, err := os.Create(filepath.Join(tmpDir, "download"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	actual, err := download(ctx, gitop.RewriteURL(archiveURL), file)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", archiveURL, err)
+	}
+	if !strings.EqualFold(actual, sum) {
+		return "", fmt.Errorf("checksum mismatch for %s, expected SHA-256 %s, got %s", archiveURL, strings.ToLower(sum), actual)
+	}
+
+	extracted := filepath.Join(tmpDir, "files")
+	if err := extract(file, extracted); err != nil {
+		return "", fmt.Errorf("failed to extract %s: %w", archiveURL, err)
+	}
+
+	// Another fetch may have extracted the same archive in the meantime
+	if err := os.Rename(extracted, dir); err != nil {
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return dir, nil
+		}
+		return "", err
+	}
+	return dir, nil
+}
+
+// download writes the body of archiveURL to w, returning its SHA-256. It stops as
+// soon as ctx is done.
+func download(ctx context.Context, archiveURL string, w io.Writer) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), resp.Body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// extract unpacks a zip, tarball or gzipped tarball into dest, telling them apart
+// by their content rather than their URL, which often has no extension.
+func extract(file *os.File, dest string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(512)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		zr, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			return err
+		}
+		return extractZip(zr, dest)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(tar.NewReader(gz), dest)
+	case len(magic) >= 262 && string(magic[257:262]) == "ustar":
+		return extractTar(tar.NewReader(reader), dest)
+	}
+	return fmt.Errorf("not a zip or tar archive")
+}
+
+func extractZip(zr *zip.Reader, dest string) error {
+	for _, f := range zr.File {
+		rel, target, err := entryPath(dest, f.Name)
+		if err != nil {
+			return err
+		}
+		if target == dest {
+			continue
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := makeDir(target, f.Name); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			linkTarget, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			if err := writeSymlink(dest, rel, string(linkTarget), target); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = writeFile(target, rc, mode)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("'%s' is not a regular file, directory or symlink", f.Name)
+		}
+	}
+	return nil
+}
+
+func extractTar(tr *tar.Reader, dest string) error {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		rel, target, err := entryPath(dest, header.Name)
+		if err != nil {
+			return err
+		}
+		if target == dest {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := makeDir(target, header.Name); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := writeSymlink(dest, rel, header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, header.FileInfo().Mode()); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("'%s' is not a regular file, directory or symlink", header.Name)
+		}
+	}
+}
+
+// entryPath returns the cleaned slash separated path of an entry of the archive
+// and where it is extracted to. It refuses names that would land outside dest,
+// directly or by going through a symlink an earlier entry created.
+func entryPath(dest, name string) (string, string, error) {
+	rel := strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(rel) || (len(rel) > 1 && rel[1] == ':') {
+		return "", "", fmt.Errorf("entry '%s' has an absolute path", name)
+	}
+	if hasDotDot(rel) {
+		return "", "", fmt.Errorf("entry '%s' points outside the archive", name)
+	}
+	rel = path.Clean(rel)
+	if rel == "." {
+		return rel, dest, nil
+	}
+	if err := checkNoLinks(dest, path.Dir(rel)); err != nil {
+		return "", "", fmt.Errorf("entry '%s' %v", name, err)
+	}
+	return rel, filepath.Join(dest, filepath.FromSlash(rel)), nil
+}
+
+func hasDotDot(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNoLinks refuses a path inside dest when any of its components exists and
+// is a symlink, or a file before the last one, which would make whatever is
+// created under it land somewhere else.
+func checkNoLinks(dest, rel string) error {
+	if rel == "." || rel == "" {
+		return nil
+	}
+	dir := dest
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("goes through symlink '%s'", filepath.ToSlash(dir[len(dest)+1:]))
+		}
+		if !info.IsDir() && i < len(parts)-1 {
+			return fmt.Errorf("goes through file '%s'", filepath.ToSlash(dir[len(dest)+1:]))
+		}
+	}
+	return nil
+}
+
+// makeDir creates the directory an entry of the archive declares, refusing to
+// reuse a symlink an earlier entry left at target.
+func makeDir(target, name string) error {
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("entry '%s' is a symlink and a directory", name)
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// writeSymlink creates the symlink an entry of the archive declares. Its target
+// must be a relative path without '..' that doesn't go through another symlink,
+// so that following it always stays inside dest.
+func writeSymlink(dest, rel, linkTarget, target string) error {
+	linkTarget = strings.ReplaceAll(linkTarget, `\`, "/")
+	if linkTarget == "" || path.IsAbs(linkTarget) || (len(linkTarget) > 1 && linkTarget[1] == ':') || hasDotDot(linkTarget) {
+		return fmt.Errorf("symlink '%s' points outside the archive", rel)
+	}
+	if err := checkNoLinks(dest, path.Join(path.Dir(rel), linkTarget)); err != nil {
+		return fmt.Errorf("symlink '%s' %v", rel, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	os.Remove(target)
+	if err := os.Symlink(filepath.FromSlash(linkTarget), target); err != nil {
+		return err
+	}
+
+	// Belt and braces: wherever the link leads has to be inside dest
+	resolved, err := filepath.EvalSymlinks(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	if inside, err := filepath.Rel(root, resolved); err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink '%s' points outside the archive", rel)
+	}
+	return nil
+}
+
+// writeFile writes a regular file, replacing whatever an earlier entry left at
+// target rather than writing through it. entryPath has made sure that none of
+// the directories leading to it is a symlink.
+func writeFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	os.Remove(target)
+
+	perm := os.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Source returns the directory an extracted archive is linked from: dir itself,
+// or the directory the strip prefix names inside it.
+func Source(dir, stripPrefix string) (string, error) {
+	source := filepath.Join(dir, filepath.FromSlash(stripPrefix))
+	if info, err := os.Stat(source); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("strip prefix '%s' not found", stripPrefix)
+	}
+	return source, nil
+}
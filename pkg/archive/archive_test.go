@@ -0,0 +1,218 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// entry is a file, directory or symlink of a test archive.
+type entry struct {
+	name string
+	body string // Contents of a file
+	link string // Target of a symlink
+	dir  bool
+}
+
+func makeTarGz(t *testing.T, entries []entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		switch {
+		case e.dir:
+			header.Typeflag, header.Mode, header.Size = tar.TypeDir, 0755, 0
+		case e.link != "":
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, e.link, 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeZip(t *testing.T, entries []entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		body := e.body
+		switch {
+		case e.dir:
+			header.SetMode(os.ModeDir | 0755)
+		case e.link != "":
+			header.SetMode(os.ModeSymlink | 0777)
+			body = e.link
+		default:
+			header.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// serve serves each archive at its path, and points the cache at a temporary
+// home directory, which it returns.
+func serve(t *testing.T, archives map[string][]byte) (*httptest.Server, string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server, home
+}
+
+func TestFetchWithStripPrefix(t *testing.T) {
+	entries := []entry{
+		{name: "addon-1.2/", dir: true},
+		{name: "addon-1.2/addons/foo/a.gd", body: "extends Node"},
+		{name: "addon-1.2/addons/foo/b.gd", link: "a.gd"},
+	}
+	for _, format := range []string{"zip", "tar.gz"} {
+		t.Run(format, func(t *testing.T) {
+			data := makeZip(t, entries)
+			if format == "tar.gz" {
+				data = makeTarGz(t, entries)
+			}
+			server, _ := serve(t, map[string][]byte{"/addon-1.2." + format: data})
+
+			dir, err := Fetch(context.Background(), server.URL+"/addon-1.2."+format, checksum(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dir != Dir(checksum(data)) {
+				t.Errorf("extracted to %s, want %s", dir, Dir(checksum(data)))
+			}
+			source, err := Source(dir, "addon-1.2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"a.gd", "b.gd"} {
+				got, err := os.ReadFile(filepath.Join(source, "addons", "foo", name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != "extends Node" {
+					t.Errorf("%s = %q, want %q", name, got, "extends Node")
+				}
+			}
+			if _, err := Source(dir, "addon-1.3"); err == nil {
+				t.Error("Source accepted a strip prefix that isn't in the archive")
+			}
+		})
+	}
+}
+
+func TestFetchChecksumMismatch(t *testing.T) {
+	data := makeTarGz(t, []entry{{name: "a.gd", body: "extends Node"}})
+	server, _ := serve(t, map[string][]byte{"/addon.tar.gz": data})
+
+	wrong := strings.Repeat("0", 64)
+	_, err := Fetch(context.Background(), server.URL+"/addon.tar.gz", wrong)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Fetch = %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(Dir(wrong)); !os.IsNotExist(err) {
+		t.Error("an archive that didn't match its checksum was extracted")
+	}
+}
+
+func TestFetchRejectsTraversal(t *testing.T) {
+	tests := map[string][]entry{
+		"dot dot entry":  {{name: "../evil", body: "x"}},
+		"absolute entry": {{name: "/evil", body: "x"}},
+		"dot dot link":   {{name: "x/link", link: "../../evil"}},
+		"absolute link":  {{name: "link", link: "/tmp"}},
+		"link chain": {
+			{name: "b", link: "."},
+			{name: "c", link: "b/b/.."},
+			{name: "c/evil", body: "x"},
+		},
+		"link through link": {
+			{name: "b", link: "."},
+			{name: "c", link: "b/sub"},
+		},
+		"file through link": {
+			{name: "sub/", dir: true},
+			{name: "b", link: "sub"},
+			{name: "b/evil", body: "x"},
+		},
+		"directory over link": {
+			{name: "b", link: "."},
+			{name: "b/", dir: true},
+		},
+	}
+
+	for name, entries := range tests {
+		for _, format := range []string{"zip", "tar.gz"} {
+			t.Run(name+" "+format, func(t *testing.T) {
+				data := makeZip(t, entries)
+				if format == "tar.gz" {
+					data = makeTarGz(t, entries)
+				}
+				server, home := serve(t, map[string][]byte{"/evil": data})
+
+				if _, err := Fetch(context.Background(), server.URL+"/evil", checksum(data)); err == nil {
+					t.Fatal("Fetch extracted a hostile archive")
+				}
+				if _, err := os.Stat(Dir(checksum(data))); !os.IsNotExist(err) {
+					t.Error("a hostile archive was left in the cache")
+				}
+				filepath.Walk(home, func(path string, info os.FileInfo, err error) error {
+					if err == nil && info.Name() == "evil" {
+						t.Errorf("wrote %s", path)
+					}
+					return nil
+				})
+			})
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 const cacheDir = ".gogetty"
 const ClientList = "clients.csv"
 const moduleDir = "modules"
+const archiveDir = "archives"
 
 // Returns the cache directory's absolute path.
 func CacheDir() string {
@@ -26,6 +27,12 @@ func ModuleDir() string {
 	return filepath.Join(CacheDir(), moduleDir)
 }
 
+// Returns the archive directory's absolute path, where downloaded archives are
+// extracted by checksum
+func ArchiveDir() string {
+	return filepath.Join(CacheDir(), archiveDir)
+}
+
 // Creates the directory structure, and writes the cache map file.
 func Init() error {
 	// Create the modules directory
@@ -99,23 +106,32 @@ func readClients() ([]string, error) {
 	return clients, nil
 }
 
+// writeClients replaces the client list through a temporary file, so concurrent
+// readers never see it half written.
 func writeClients(clients []string) error {
 	cacheFilePath := filepath.Join(CacheDir(), ClientList)
 
-	file, err := os.Create(cacheFilePath)
+	file, err := os.CreateTemp(CacheDir(), ".tmp-"+ClientList+"-")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer os.Remove(file.Name())
 
 	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
 	for _, client := range clients {
 		if err := writer.Write([]string{client}); err != nil {
+			file.Close()
 			return err
 		}
 	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
 
-	return nil
+	return os.Rename(file.Name(), cacheFilePath)
 }
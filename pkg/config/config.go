@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"gogetty/pkg/cache"
+	"gogetty/pkg/gitop"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const ConfigJson = "config.json"
+
+// Config holds the user's settings, shared by every project on the machine.
+type Config struct {
+	GitBackend  string                      `json:"gitBackend,omitempty"`  // auto, exec or go, see gitop.UseBackend
+	Credentials map[string]gitop.Credential `json:"credentials,omitempty"` // Keyed by host, or host:port
+	URLRewrites []gitop.Rewrite             `json:"urlRewrites,omitempty"` // Applied to every repository URL, see gitop.RewriteURL
+	Offline     bool                        `json:"offline,omitempty"`     // Never contact remotes, see gitop.UseOffline
+	Network     Network                     `json:"network"`               // Timeouts and retries of remote operations
+}
+
+// Network overrides gitop.DefaultNetworkOptions. Timeouts are durations such as
+// "90s" or "10m", and "0" turns a timeout off.
+type Network struct {
+	CloneTimeout    string `json:"cloneTimeout,omitempty"`
+	ListTimeout     string `json:"listTimeout,omitempty"`
+	PopulateTimeout string `json:"populateTimeout,omitempty"`
+	Retries         *int   `json:"retries,omitempty"`
+	RetryDelay      string `json:"retryDelay,omitempty"`
+}
+
+// Options returns the default network options with the ones set here applied.
+func (n Network) Options() (gitop.NetworkOptions, error) {
+	opts := gitop.DefaultNetworkOptions
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"cloneTimeout", n.CloneTimeout, &opts.CloneTimeout},
+		{"listTimeout", n.ListTimeout, &opts.ListTimeout},
+		{"populateTimeout", n.PopulateTimeout, &opts.PopulateTimeout},
+		{"retryDelay", n.RetryDelay, &opts.RetryDelay},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil || duration < 0 {
+			return opts, fmt.Errorf("network %s must be a duration such as '90s' or '10m', not '%s'", d.name, d.value)
+		}
+		*d.dest = duration
+	}
+
+	if n.Retries != nil {
+		if *n.Retries < 0 {
+			return opts, fmt.Errorf("network retries can't be negative")
+		}
+		opts.Retries = *n.Retries
+	}
+	return opts, nil
+}
+
+// Environment variables overriding the config file
+const (
+	GitBackendEnv = "GOGETTY_GIT_BACKEND"
+	OfflineEnv    = "GOGETTY_OFFLINE"
+)
+
+// Path returns the absolute path of the config file in the cache directory.
+func Path() string {
+	return filepath.Join(cache.CacheDir(), ConfigJson)
+}
+
+// Load reads the config file, which is optional, and applies the environment
+// variables on top of it.
+func Load() (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(Path())
+	if err != nil && !os.IsNotExist(err) {
+		return config, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, fmt.Errorf("error reading %s: %v", Path(), err)
+		}
+	}
+
+	if backend := os.Getenv(GitBackendEnv); backend != "" {
+		config.GitBackend = backend
+	}
+
+	if offline := os.Getenv(OfflineEnv); offline != "" {
+		on, err := strconv.ParseBool(offline)
+		if err != nil {
+			return config, fmt.Errorf("%s must be true or false, not '%s'", OfflineEnv, offline)
+		}
+		config.Offline = on
+	}
+
+	return config, nil
+}
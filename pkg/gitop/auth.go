@@ -0,0 +1,226 @@
+package gitop
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// Credential tells how to authenticate to a git host. Only where to find the
+// secrets is configured, never the secrets themselves.
+type Credential struct {
+	SSHKey   string `json:"sshKey,omitempty"`   // Private key file used for ssh URLs
+	TokenEnv string `json:"tokenEnv,omitempty"` // Environment variable holding a token, sent as the password for https URLs
+	Username string `json:"username,omitempty"` // Sent with the token, defaults to "git"
+	Helper   string `json:"helper,omitempty"`   // git credential helper used for https URLs, e.g. "store" or "!my-helper"
+}
+
+const defaultTokenUser = "git"
+
+var credentials map[string]Credential
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// UseCredentials sets the credentials of each host, given by name or as host:port,
+// which are then used whenever a remote is cloned, fetched or listed.
+func UseCredentials(hosts map[string]Credential) error {
+	credentials = map[string]Credential{}
+	for host, cred := range hosts {
+		if cred.TokenEnv != "" && cred.Helper != "" {
+			return fmt.Errorf("credentials for %s set both a token and a credential helper, use one of them", host)
+		}
+		if cred.TokenEnv != "" && !envName.MatchString(cred.TokenEnv) {
+			return fmt.Errorf("credentials for %s: '%s' is not a valid environment variable name", host, cred.TokenEnv)
+		}
+		if strings.HasPrefix(cred.SSHKey, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			cred.SSHKey = filepath.Join(home, cred.SSHKey[2:])
+		}
+		credentials[strings.ToLower(host)] = cred
+	}
+	return nil
+}
+
+// credentialFor returns the credentials of the host gitURL points at, preferring
+// ones given for its port, along with the host they were given for.
+func credentialFor(gitURL string) (*transport.Endpoint, string, Credential, bool) {
+	ep, err := transport.NewEndpoint(gitURL)
+	if err != nil || ep.Host == "" {
+		return nil, "", Credential{}, false
+	}
+	host := strings.ToLower(ep.Host)
+	if ep.Port != 0 {
+		if cred, ok := credentials[hostPort(ep)]; ok {
+			return ep, hostPort(ep), cred, true
+		}
+	}
+	cred, ok := credentials[host]
+	return ep, host, cred, ok
+}
+
+func hostPort(ep *transport.Endpoint) string {
+	host := strings.ToLower(ep.Host)
+	if ep.Port != 0 {
+		host += ":" + strconv.Itoa(ep.Port)
+	}
+	return host
+}
+
+// token reads the token of a credential from the environment.
+func (c Credential) token() (string, error) {
+	token := os.Getenv(c.TokenEnv)
+	if token == "" {
+		return "", fmt.Errorf("the token for this host is read from %s, which is not set", c.TokenEnv)
+	}
+	return token, nil
+}
+
+func (c Credential) username() string {
+	if c.Username != "" {
+		return c.Username
+	}
+	return defaultTokenUser
+}
+
+// execAuthConfig returns the -c options giving git the credentials for gitURL.
+// Credentials are only sent over https, and helpers are scoped to their host, so
+// submodules on other hosts never see them. Tokens stay in the environment, the
+// helper reading them is all that appears on the command line.
+func execAuthConfig(gitURL string) ([]string, error) {
+	var args []string
+
+	ep, matched, cred, ok := credentialFor(gitURL)
+	if ok && ep.Protocol == "https" && cred.TokenEnv != "" {
+		// Fail early rather than letting git prompt for a password
+		if _, err := cred.token(); err != nil {
+			return nil, err
+		}
+	}
+	if ok && ep.Protocol == "ssh" && cred.SSHKey != "" {
+		args = append(args, "-c", "core.sshCommand=ssh -i "+shellQuote(cred.SSHKey)+" -o IdentitiesOnly=yes")
+	}
+
+	hosts := make([]string, 0, len(credentials))
+	for host := range credentials {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		c := credentials[host]
+		helper := c.Helper
+		if c.TokenEnv != "" {
+			helper = fmt.Sprintf(`!f() { test "$1" = get && echo %s && echo "password=$%s"; }; f`, shellQuote("username="+c.username()), c.TokenEnv)
+		}
+		if helper == "" {
+			continue
+		}
+		// git only matches the port given, so the host of gitURL is spelled out in full
+		scope := host
+		if ok && host == matched {
+			scope = hostPort(ep)
+		}
+		// The empty helper drops the ones from the user's git config for this host
+		key := "credential.https://" + scope + ".helper"
+		args = append(args, "-c", key+"=", "-c", key+"="+helper)
+	}
+	return args, nil
+}
+
+// goAuthMethod returns the go-git authentication for gitURL, or nil to use the
+// defaults, which for ssh is the running ssh agent.
+func goAuthMethod(gitURL string) (transport.AuthMethod, error) {
+	ep, _, cred, ok := credentialFor(gitURL)
+	if !ok {
+		return nil, nil
+	}
+
+	switch ep.Protocol {
+	case "ssh":
+		if cred.SSHKey == "" {
+			return nil, nil
+		}
+		user := ep.User
+		if user == "" {
+			user = gitssh.DefaultUsername
+		}
+		auth, err := gitssh.NewPublicKeysFromFile(user, cred.SSHKey, "")
+		if err != nil {
+			return nil, fmt.Errorf("error reading ssh key %s: %v", cred.SSHKey, err)
+		}
+		return auth, nil
+	case "https":
+		if cred.TokenEnv != "" {
+			token, err := cred.token()
+			if err != nil {
+				return nil, err
+			}
+			return &githttp.BasicAuth{Username: cred.username(), Password: token}, nil
+		}
+		if cred.Helper != "" {
+			return fillCredential(cred.Helper, ep)
+		}
+	}
+	return nil, nil
+}
+
+// fillCredential asks a git credential helper for the username and password of
+// a host, naming the helper the way git does.
+func fillCredential(helper string, ep *transport.Endpoint) (transport.AuthMethod, error) {
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		cmd = exec.Command("sh", "-c", helper[1:]+" get")
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", helper[1:]+" get")
+		}
+	case filepath.IsAbs(helper):
+		cmd = exec.Command(helper, "get")
+	default:
+		fields := strings.Fields(helper)
+		cmd = exec.Command("git-credential-"+fields[0], append(fields[1:], "get")...)
+	}
+
+	host := hostPort(ep)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", ep.Protocol, host, strings.TrimPrefix(ep.Path, "/")))
+	cmd.Stderr = os.Stderr
+
+	// The output holds the password, so it never goes into an error message
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper '%s' failed for %s: %v", helper, host, err)
+	}
+	auth := &githttp.BasicAuth{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "username":
+			auth.Username = value
+		case "password":
+			auth.Password = value
+		}
+	}
+	if auth.Password == "" {
+		return nil, fmt.Errorf("credential helper '%s' returned no password for %s", helper, host)
+	}
+	return auth, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,94 @@
+package gitop
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// Backend performs the git operations gogetty needs. The exec backend runs the
+// git binary, while the go backend works in-process so gogetty also runs on
+// machines without git installed. Operations that may talk to a remote take a
+// context, and stop when it is done.
+type Backend interface {
+	// Clone makes a shallow clone of ref, a branch or tag, into the empty directory
+	// dir. The remote's default branch is cloned when ref is empty. With sparse
+	// directories only those are checked out, see SparseCheckout.
+	Clone(ctx context.Context, gitURL, ref, dir string, sparse []string) error
+	// FetchCommit checks out commit into the empty directory dir, keeping it on
+	// branch when one is given. The commit may be abbreviated.
+	FetchCommit(ctx context.Context, gitURL, branch, commit, dir string, sparse []string) error
+	// ResolveRef returns the full SHA of a revision such as HEAD or HEAD^{tree}.
+	ResolveRef(repoDir, rev string) (string, error)
+	// ModifiedFiles lists the tracked files of repoDir that differ from the commit
+	// checked out, relative to repoDir. Untracked files are left out.
+	ModifiedFiles(repoDir string) ([]string, error)
+	// ReadFile returns a file as committed at rev, a revision such as HEAD.
+	ReadFile(repoDir, rev, name string) ([]byte, error)
+	// CloneHistory makes a bare clone of the commits of ref, a branch or tag, or of
+	// the default branch when ref is empty, into the empty directory dir. Only the
+	// last depth commits are cloned, or all of them when depth is 0.
+	CloneHistory(ctx context.Context, gitURL, ref, dir string, depth int) error
+	// Log lists the commits between from and to, see Log. It returns ErrNoHistory
+	// when either commit is missing, or from isn't an ancestor of to in repoDir.
+	Log(repoDir, from, to string) ([]Commit, error)
+	// ListRemote lists the references of a remote repository like git ls-remote,
+	// with peeled tags suffixed by ^{}.
+	ListRemote(ctx context.Context, gitURL string) ([]RemoteRef, error)
+	// ReadHead reads the origin URL, and the branch and commit checked out in repoDir.
+	ReadHead(repoDir string) (GitRepo, error)
+	// UpdateSubmodules initializes the submodules of repoDir, recursively, at the
+	// commits recorded in the checked out revision.
+	UpdateSubmodules(ctx context.Context, repoDir string) error
+	// PullLFS replaces the Git LFS pointer files checked out in repoDir with their content.
+	PullLFS(ctx context.Context, repoDir string) error
+	// SparseCheckout limits the working tree of repoDir to dirs, in git's cone mode:
+	// the files at the top of the repository and next to each directory are kept
+	// too. Without dirs the whole tree is checked out again.
+	SparseCheckout(ctx context.Context, repoDir string, dirs []string) error
+	// SparseDirectories returns the directories of a sparse checkout, and false when
+	// the whole tree is checked out.
+	SparseDirectories(repoDir string) ([]string, bool, error)
+}
+
+type RemoteRef struct {
+	Name string // Full name of the reference, e.g. refs/tags/v1.0.0
+	Hash string
+}
+
+// Names of the available backends
+const (
+	BackendAuto = "auto" // exec when git is installed, go otherwise
+	BackendExec = "exec"
+	BackendGo   = "go"
+)
+
+var backend Backend = execBackend{}
+
+// UseBackend selects the backend every git operation goes through. An empty name
+// is the same as BackendAuto.
+func UseBackend(name string) error {
+	switch name {
+	case "", BackendAuto:
+		if gitInstalled() {
+			backend = execBackend{}
+		} else {
+			backend = goBackend{}
+		}
+	case BackendExec:
+		if !gitInstalled() {
+			return fmt.Errorf("the %s git backend requires git, but it was not found in PATH; install it from https://git-scm.com or use the %s backend", BackendExec, BackendGo)
+		}
+		backend = execBackend{}
+	case BackendGo:
+		backend = goBackend{}
+	default:
+		return fmt.Errorf("unknown git backend '%s', expected %s, %s or %s", name, BackendAuto, BackendExec, BackendGo)
+	}
+	return nil
+}
+
+func gitInstalled() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
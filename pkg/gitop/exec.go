@@ -0,0 +1,334 @@
+package gitop
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// execBackend runs the git binary.
+type execBackend struct{}
+
+// killWait is how long a killed git may keep its output open before it is
+// abandoned. Nothing it writes by then is used anyway.
+const killWait = 500 * time.Millisecond
+
+// Clone makes a partial clone for sparse checkouts, so blobs outside the sparse
+// directories are never downloaded.
+func (b execBackend) Clone(ctx context.Context, gitURL, ref, dir string, sparse []string) error {
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if len(sparse) > 0 {
+		args = append(args, "--filter=blob:none", "--sparse")
+	}
+	if err := runRemote(ctx, "", gitURL, append(args, gitURL, dir)...); err != nil {
+		return err
+	}
+	if len(sparse) > 0 {
+		return b.SparseCheckout(ctx, dir, sparse)
+	}
+	return nil
+}
+
+// deepenSteps are the amounts of history fetched in turn while looking for a
+// commit the server won't hand out directly, before giving up and fetching it all.
+var deepenSteps = []int{50, 500}
+
+// FetchCommit fetches only the commit when given its full SHA, which most servers
+// allow. Otherwise, and for abbreviated SHAs, the branch is cloned shallowly and
+// its history deepened until the commit turns up.
+func (b execBackend) FetchCommit(ctx context.Context, gitURL, branch, commit, dir string, sparse []string) error {
+	if err := runGit(dir, "init", "--quiet"); err != nil {
+		return err
+	}
+	if err := runGit(dir, "remote", "add", "origin", gitURL); err != nil {
+		return err
+	}
+
+	// Make it a partial clone, every fetch below then leaves out blobs until they're checked out
+	if len(sparse) > 0 {
+		if err := runGit(dir, "config", "remote.origin.promisor", "true"); err != nil {
+			return err
+		}
+		if err := runGit(dir, "config", "remote.origin.partialclonefilter", "blob:none"); err != nil {
+			return err
+		}
+		if err := b.SparseCheckout(ctx, dir, sparse); err != nil {
+			return err
+		}
+	}
+
+	if err := runRemote(ctx, dir, gitURL, "fetch", "--quiet", "--depth", "1", "origin", commit); err != nil {
+		if err := deepenUntil(ctx, dir, gitURL, branch, commit); err != nil {
+			return err
+		}
+	}
+
+	// Keep the branch checked out by name, so the clone is recognized as being on it
+	args := []string{"checkout", "--quiet", "--detach", commit}
+	if branch != "" {
+		args = []string{"checkout", "--quiet", "-B", branch, commit}
+	}
+	return runRemote(ctx, dir, gitURL, args...)
+}
+
+func deepenUntil(ctx context.Context, dir, gitURL, branch, commit string) error {
+	ref := branch
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := runRemote(ctx, dir, gitURL, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+		return err
+	}
+
+	for _, depth := range deepenSteps {
+		if hasCommit(dir, commit) {
+			return nil
+		}
+		if err := runRemote(ctx, dir, gitURL, "fetch", "--quiet", "--deepen", strconv.Itoa(depth), "origin", ref); err != nil {
+			return err
+		}
+	}
+	if hasCommit(dir, commit) {
+		return nil
+	}
+
+	// Last resort, the commit may be further back or on another branch
+	args := []string{"fetch", "--quiet", "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*"}
+	if isShallow(dir) {
+		args = append(args[:2], append([]string{"--unshallow"}, args[2:]...)...)
+	}
+	if err := runRemote(ctx, dir, gitURL, args...); err != nil {
+		return err
+	}
+	if hasCommit(dir, commit) {
+		return nil
+	}
+
+	return missingCommit(gitURL, branch, commit)
+}
+
+func hasCommit(dir, commit string) bool {
+	return runGit(dir, "cat-file", "-e", commit+"^{commit}") == nil
+}
+
+func isShallow(dir string) bool {
+	out, err := outputGit(dir, "rev-parse", "--is-shallow-repository")
+	return err == nil && out == "true"
+}
+
+func (execBackend) ResolveRef(repoDir, rev string) (string, error) {
+	return outputGit(repoDir, "rev-parse", "--verify", "--quiet", rev)
+}
+
+func (execBackend) ModifiedFiles(repoDir string) ([]string, error) {
+	out, err := outputGit(repoDir, "diff", "HEAD", "--name-only", "--no-renames", "-z")
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(out, "\x00"), "\x00"), nil
+}
+
+func (execBackend) ReadFile(repoDir, rev, name string) ([]byte, error) {
+	return gitOutput(context.Background(), repoDir, nil, []string{"cat-file", "blob", rev + ":" + name})
+}
+
+// CloneHistory leaves out trees and blobs where the server allows it, a log only
+// needs the commits.
+func (execBackend) CloneHistory(ctx context.Context, gitURL, ref, dir string, depth int) error {
+	args := []string{"clone", "--quiet", "--bare", "--single-branch", "--filter=tree:0"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	return runRemote(ctx, "", gitURL, append(args, gitURL, dir)...)
+}
+
+func (execBackend) Log(repoDir, from, to string) ([]Commit, error) {
+	// A shallow clone may lack the commits joining them, which makes them unrelated
+	if err := runGit(repoDir, "merge-base", "--is-ancestor", from, to); err != nil {
+		return nil, ErrNoHistory
+	}
+	out, err := outputGit(repoDir, "log", "--format=%H%x00%an%x00%s", from+".."+to)
+	if err != nil || out == "" {
+		return nil, err
+	}
+
+	var commits []Commit
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) == 3 {
+			commits = append(commits, Commit{Hash: fields[0], Author: fields[1], Subject: fields[2]})
+		}
+	}
+	return commits, nil
+}
+
+func (execBackend) ListRemote(ctx context.Context, gitURL string) ([]RemoteRef, error) {
+	out, err := outputRemote(ctx, "", gitURL, "ls-remote", gitURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []RemoteRef
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		// Example line: "<sha>\trefs/tags/v1.2.0^{}"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		refs = append(refs, RemoteRef{Name: fields[1], Hash: fields[0]})
+	}
+	return refs, scanner.Err()
+}
+
+func (execBackend) ReadHead(repoDir string) (GitRepo, error) {
+	repo := GitRepo{Path: repoDir}
+
+	// Clones fetched from a mirror record the URL they are known by, see recordURL
+	url, err := outputGit(repoDir, "config", "--get", "gogetty.url")
+	if err != nil {
+		url, err = outputGit(repoDir, "config", "--get", "remote.origin.url")
+	}
+	if err != nil {
+		return repo, fmt.Errorf("error fetching repository URL: %v", err)
+	}
+	repo.URL = url
+
+	// symbolic-ref fails on a detached HEAD, as left by cloning a tag
+	if branch, err := outputGit(repoDir, "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		repo.Branch = branch
+	}
+
+	commit, err := outputGit(repoDir, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		return repo, fmt.Errorf("error fetching latest commit: %v", err)
+	}
+	repo.Commit = commit
+
+	return repo, nil
+}
+
+// UpdateSubmodules hands the rewrite rules to git, which clones the submodules itself.
+func (execBackend) UpdateSubmodules(ctx context.Context, repoDir string) error {
+	url, err := outputGit(repoDir, "config", "--get", "remote.origin.url")
+	if err != nil {
+		return fmt.Errorf("error fetching repository URL: %v", err)
+	}
+	if err := checkOnline(url); err != nil {
+		return err
+	}
+	auth, err := execAuthConfig(url)
+	if err != nil {
+		return fmt.Errorf("error authenticating to %s: %v", url, err)
+	}
+	var config []string
+	for _, rule := range rewrites {
+		config = append(config, "-c", "url."+rule.URL+".insteadOf="+rule.InsteadOf)
+	}
+	_, err = gitCommand(ctx, repoDir, append(auth, config...), []string{"submodule", "update", "--init", "--recursive", "--quiet"})
+	return err
+}
+
+func (execBackend) PullLFS(ctx context.Context, repoDir string) error {
+	if err := runGit(repoDir, "lfs", "version"); err != nil {
+		return fmt.Errorf("git-lfs is not installed, install it from https://git-lfs.com")
+	}
+	return runOrigin(ctx, repoDir, "lfs", "pull")
+}
+
+func (execBackend) SparseCheckout(ctx context.Context, repoDir string, dirs []string) error {
+	if len(dirs) == 0 {
+		return runOrigin(ctx, repoDir, "sparse-checkout", "disable")
+	}
+	// Paths of files are allowed, cone mode checks out the files next to them anyway
+	return runOrigin(ctx, repoDir, append([]string{"sparse-checkout", "set", "--cone", "--skip-checks", "--"}, dirs...)...)
+}
+
+func (execBackend) SparseDirectories(repoDir string) ([]string, bool, error) {
+	// git config fails when the option isn't set at all
+	if enabled, err := outputGit(repoDir, "config", "--bool", "core.sparseCheckout"); err != nil || enabled != "true" {
+		return nil, false, nil
+	}
+	out, err := outputGit(repoDir, "sparse-checkout", "list")
+	if err != nil {
+		return nil, false, err
+	}
+	return strings.Split(out, "\n"), true, nil
+}
+
+// runGit runs a git command in dir, returning its error output on failure.
+func runGit(dir string, args ...string) error {
+	_, err := outputGit(dir, args...)
+	return err
+}
+
+// outputGit runs a git command in dir and returns its trimmed output.
+func outputGit(dir string, args ...string) (string, error) {
+	return gitCommand(context.Background(), dir, nil, args)
+}
+
+// runRemote runs a git command talking to gitURL, with the credentials of its host.
+func runRemote(ctx context.Context, dir, gitURL string, args ...string) error {
+	_, err := outputRemote(ctx, dir, gitURL, args...)
+	return err
+}
+
+func outputRemote(ctx context.Context, dir, gitURL string, args ...string) (string, error) {
+	if err := checkOnline(gitURL); err != nil {
+		return "", err
+	}
+	auth, err := execAuthConfig(gitURL)
+	if err != nil {
+		return "", fmt.Errorf("error authenticating to %s: %v", gitURL, err)
+	}
+	return gitCommand(ctx, dir, auth, args)
+}
+
+// runOrigin runs a git command that may download from the origin of the clone in
+// dir, such as checking out files a partial clone left out.
+func runOrigin(ctx context.Context, dir string, args ...string) error {
+	url, err := outputGit(dir, "config", "--get", "remote.origin.url")
+	if err != nil {
+		return fmt.Errorf("error fetching repository URL: %v", err)
+	}
+	return runRemote(ctx, dir, url, args...)
+}
+
+// gitCommand runs git with the config options, which are left out of errors. git
+// is killed once ctx is done.
+func gitCommand(ctx context.Context, dir string, config, args []string) (string, error) {
+	out, err := gitOutput(ctx, dir, config, args)
+	return strings.TrimSpace(string(out)), err
+}
+
+// gitOutput is gitCommand returning the output untouched.
+func gitOutput(ctx context.Context, dir string, config, args []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append(append([]string{}, config...), args...)...)
+	cmd.Dir = dir
+	killGroup(cmd)
+	cmd.WaitDelay = killWait
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %v: %s", args[0], err, msg)
+		}
+		return nil, fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return out, nil
+}
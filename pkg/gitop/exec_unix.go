@@ -0,0 +1,17 @@
+//go:build !windows
+
+package gitop
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroup makes cancelling cmd kill the helpers git starts as well, like
+// git-remote-https, which would otherwise go on waiting on a hung server.
+func killGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,7 @@
+package gitop
+
+import "os/exec"
+
+// killGroup leaves cancelling to exec.CommandContext, which kills git alone.
+// Helpers it started exit once their pipes to git close.
+func killGroup(cmd *exec.Cmd) {}
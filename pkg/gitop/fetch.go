@@ -1,88 +1,172 @@
 package gitop
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"gogetty/pkg/godot"
-	"net/url"
-	"os/exec"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
-func Fetch(cacheDir, gitURL, branch, commit string) (*GitRepo, error) {
+// Fetch clones a repository into the cache. Each clone lives in a directory named
+// after the repository's URL and the commit it resolved to, see ModuleKey, so
+// different versions of a repository never overwrite one another. With sparse
+// directories only those are checked out, see Populate for widening them later.
+// The URL is rewritten, see RewriteURL, and the mirrors are tried in turn when it
+// can't be fetched; the clone is still known by the URL. Each source is retried
+// after transient failures, see NetworkOptions.
+func Fetch(ctx context.Context, cacheDir, gitURL string, mirrors []string, branch, commit string, sparse []string) (*GitRepo, error) {
 	// Derive the name from the gitURL
-	parsedURL, err := url.Parse(gitURL)
-	if err != nil {
-		return &GitRepo{}, err
-	}
-
-	// Extract the repository name from the URL
-	name := path.Base(parsedURL.Path)
+	name := path.Base(NormalizeURL(gitURL))
 
 	// Strip file extensions, if any
 	name = strings.TrimSuffix(name, ".git")
 	name = strings.TrimSuffix(name, ".bundle") // Add more extensions if needed
 
-	if name == "." || name == "/" {
+	if name == "." || name == "/" || name == "" {
 		return &GitRepo{}, fmt.Errorf("invalid gitURL: %s", gitURL)
 	}
 
-	// Append the name to the cacheDir
-	fullCacheDir := filepath.Join(cacheDir, name)
-
-	// Use ConstructGitCommand to build the command
-	gitCommand := constructFetchCommand(gitURL, branch, commit, fullCacheDir)
-
-	// Split the command for execution
-	cmdParts := strings.Fields(gitCommand)
-	cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
-	cmd.Dir = cacheDir
+	sparse = mergeDirectories(nil, sparse)
+
+	var tmpDir string
+	err := fromSources(ctx, gitURL, mirrors, func(source string) error {
+		return withRetry(ctx, network.CloneTimeout, func(ctx context.Context) error {
+			// Clone into a temporary directory first, the final one depends on the
+			// resolved commit. Scan skips it, so an interrupted clone is never used
+			dir, err := os.MkdirTemp(cacheDir, tmpPrefix+name+"-")
+			if err != nil {
+				return err
+			}
+
+			// Clone the tip of the branch, or exactly the pinned commit
+			if commit == "" {
+				err = backend.Clone(ctx, source, branch, dir, sparse)
+			} else {
+				err = backend.FetchCommit(ctx, source, branch, commit, dir, sparse)
+			}
+			if err == nil && source != gitURL {
+				err = recordURL(dir, gitURL)
+			}
+			if err != nil {
+				os.RemoveAll(dir)
+				return err
+			}
+			tmpDir = dir
+			return nil
+		})
+	})
+	if err != nil {
+		return &GitRepo{}, err
+	}
+	defer os.RemoveAll(tmpDir)
 
-	// Run the command and handle errors
-	if err := cmd.Run(); err != nil {
+	// Record the commit that was actually checked out
+	head, err := ResolveHead(tmpDir)
+	if err != nil {
 		return &GitRepo{}, err
 	}
 
 	// Create and populate a GitRepo object
+	fullCacheDir := filepath.Join(cacheDir, ModuleKey(name, gitURL, head))
 	repo := GitRepo{
 		Path:   fullCacheDir,
 		URL:    gitURL,
 		Branch: branch,
-		Commit: commit,
+		Commit: head,
 		Name:   name,
 	}
 
-	godotProject, err := godot.GetGodotProject(fullCacheDir)
-	if err != nil {
-		fmt.Printf("Error while getting godot project: %v\n", err)
+	// Another project may have cached this exact commit in the meantime
+	if _, err := os.Stat(fullCacheDir); err == nil {
 		return &repo, nil
 	}
-
-	err = godot.UpdateProjectPaths(*godotProject)
-	if err != nil {
-		fmt.Printf("Error while updating project paths: %v\n", err)
-		return &repo, nil
+	if err := os.Rename(tmpDir, fullCacheDir); err != nil {
+		// Or just now, in which case its clone is as good as this one
+		if _, statErr := os.Stat(fullCacheDir); statErr == nil {
+			return &repo, nil
+		}
+		return &GitRepo{}, err
 	}
 
+	rewriteGodotPaths(fullCacheDir)
+
 	return &repo, nil
 }
 
-func constructFetchCommand(gitURL, branch, commit, cacheDir string) string {
-	args := []string{"clone", "--depth", "1"}
-	if branch != "" {
-		args = append(args, "--branch", branch)
+// tmpPrefix starts the names of clones still being written to the cache.
+const tmpPrefix = ".tmp-"
+
+// RemoveStaleClones removes the temporary clones left in the cache by fetches
+// that were killed before they could clean up. Clones younger than age may belong
+// to a fetch still running.
+func RemoveStaleClones(cacheDir string, age time.Duration) error {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tmpPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < age {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(cacheDir, entry.Name())); err != nil {
+			return err
+		}
 	}
-	args = append(args, gitURL)
+	return nil
+}
 
-	// Construct checkout part if commit is specified
-	if commit != "" {
-		checkoutPart := []string{"&&", "git", "checkout", commit}
-		args = append(args, checkoutPart...)
+// rewriteGodotPaths points the res:// and user:// paths of a Godot project's
+// scripts at the clone. Rewritten scripts are left alone, so it can run again
+// whenever more of the clone is checked out.
+func rewriteGodotPaths(repoDir string) {
+	godotProject, err := godot.GetGodotProject(repoDir)
+	if err != nil {
+		// Repositories without a project.godot aren't Godot projects
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(output, "Error while getting godot project: %v\n", err)
+		}
+		return
 	}
 
-	// Append the cacheDir as the target directory
-	args = append(args, cacheDir)
+	err = godot.UpdateProjectPaths(*godotProject)
+	if err != nil {
+		fmt.Fprintf(output, "Error while updating project paths: %v\n", err)
+	}
+}
 
-	return "git " + strings.Join(args, " ")
+// onlyPathsRewritten reports whether a file differs from HEAD by nothing but the
+// changes rewriteGodotPaths makes.
+func onlyPathsRewritten(repoDir, name string) bool {
+	if !godot.IsScript(name) {
+		return false
+	}
+	current, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(name)))
+	if err != nil {
+		return false
+	}
+	original, err := backend.ReadFile(repoDir, "HEAD", name)
+	if err != nil {
+		return false
+	}
+	godotProject, err := godot.ReadProjectSettings(repoDir)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(godot.RewriteScript(original, *godotProject), current)
+}
+
+func missingCommit(gitURL, branch, commit string) error {
+	if branch != "" {
+		return fmt.Errorf("commit %s does not exist in %s (branch %s)", commit, gitURL, branch)
+	}
+	return fmt.Errorf("commit %s does not exist in %s", commit, gitURL)
 }
@@ -5,70 +5,54 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime/debug"
 	"strings"
 )
 
 type GitRepo struct {
-	Path   string // Physical path of the repository
+	Path   string `json:"Path,omitempty"` // Physical path of the repository
 	URL    string // Repository URL from the .git/config
 	Branch string // Repository Branch from HEAD
 	Commit string // Repository Commit from .git/refs/heads/{Branch}
 	Name   string // Name derived from URL
 }
 
+// Find returns the clone matching the template's URL, branch and commit, each of
+// which is ignored when empty. Without a commit, several clones of a branch may
+// match; since any of them would be a guess, Find then returns nil unless they
+// are all at the same commit.
 func Find(template GitRepo, repos []GitRepo) *GitRepo {
+	var found *GitRepo
 	for i, repo := range repos {
-		if (template.URL == "" || repo.URL == template.URL) &&
+		// A clone made under other rewrite rules is the same repository once rewritten
+		if (template.URL == "" || SameURL(RewriteURL(repo.URL), RewriteURL(template.URL))) &&
 			(template.Branch == "" || repo.Branch == template.Branch) &&
-			(template.Commit == "" || repo.Commit == template.Commit) {
-			return &repos[i] // Return a pointer to the actual slice element
+			(template.Commit == "" || strings.HasPrefix(repo.Commit, template.Commit)) {
+			if template.Commit != "" {
+				return &repos[i] // Return a pointer to the actual slice element
+			}
+			if found != nil && found.Commit != repo.Commit {
+				return nil
+			}
+			found = &repos[i]
 		}
 	}
-	return nil // Return nil if no matching GitRepo is found
+	return found // nil if no matching GitRepo is found
 }
 
 func getRepository(repoDir string) (GitRepo, error) {
-	var repo GitRepo
-
-	// Define common paths
-	gitDir := filepath.Join(repoDir, ".git")
-	configPath := filepath.Join(gitDir, "config")
-	headPath := filepath.Join(gitDir, "HEAD")
-	shallowPath := filepath.Join(gitDir, "shallow")
-
 	// Check if .git directory exists to validate the Git repository
-	if _, err := os.Stat(gitDir); err != nil {
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); err != nil {
 		if os.IsNotExist(err) {
-			return repo, fmt.Errorf("not a valid Git repository: %s", repoDir)
+			return GitRepo{}, fmt.Errorf("not a valid Git repository: %s", repoDir)
 		}
-		return repo, err
-	}
-
-	repo.Path = repoDir
-
-	// Fetch Repository URL
-	url, err := getRepoURL(configPath)
-	if err != nil {
-		return repo, fmt.Errorf("error fetching repository URL: %v", err)
-	}
-	repo.URL = strings.TrimSpace(url)
-	repo.Name = strings.TrimSpace(GetNameFromURL(url))
-
-	// Fetch Current Branch
-	branch, err := getCurrentBranch(headPath)
-	if err != nil {
-		return repo, fmt.Errorf("error fetching current branch: %v", err)
+		return GitRepo{}, err
 	}
-	repo.Branch = strings.TrimSpace(branch)
 
-	// Fetch Latest Commit
-	commit, err := os.ReadFile(shallowPath)
+	repo, err := backend.ReadHead(repoDir)
 	if err != nil {
-		debug.PrintStack()
-		return repo, fmt.Errorf("error fetching latest commit: %v", err)
+		return repo, err
 	}
-	repo.Commit = strings.TrimSpace(string(commit))
+	repo.Name = GetNameFromURL(repo.URL)
 
 	return repo, nil
 }
@@ -79,42 +63,6 @@ func GetNameFromURL(gitURL string) string {
 	return strings.TrimSuffix(lastPart, ".git")
 }
 
-func getRepoURL(configPath string) (string, error) {
-	file, err := os.Open(configPath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, "url =") {
-			parts := strings.Split(line, "=")
-			if len(parts) == 2 {
-				return strings.TrimSpace(parts[1]), nil
-			}
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return "", err
-	}
-	return "", fmt.Errorf("repository URL not found in git config")
-}
-
-func getCurrentBranch(headPath string) (string, error) {
-	data, err := os.ReadFile(headPath)
-	if err != nil {
-		return "", err
-	}
-	// Example content: "ref: refs/heads/main"
-	if strings.HasPrefix(string(data), "ref: ") {
-		parts := strings.Split(string(data), "/")
-		return parts[len(parts)-1], nil
-	}
-	return "", fmt.Errorf("current branch not found")
-}
-
 // Ignore appends multiple ignoreStrings to the .gitignore file in the specified GitRepo.
 func Ignore(repoDir string, ignoreStrings ...string) error {
 	// Construct the path to the .gitignore file in the repository
@@ -136,7 +84,7 @@ func Ignore(repoDir string, ignoreStrings ...string) error {
 	for _, ignoreString := range ignoreStrings {
 		// Check if ignoreString already exists in file
 		if strings.Contains(string(content), ignoreString) {
-			fmt.Printf("Ignore string '%s' already exists in .gitignore\n", ignoreString)
+			fmt.Fprintf(output, "Ignore string '%s' already exists in .gitignore\n", ignoreString)
 			continue
 		}
 
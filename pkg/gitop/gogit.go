@@ -0,0 +1,823 @@
+package gitop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func init() {
+	// go-git serves local repositories through git-upload-pack, serve them in-process instead
+	client.InstallProtocol("file", server.NewServer(localLoader{}))
+}
+
+// localLoader opens the local repositories served in-process, with or without a
+// worktree. The default loader only finds bare ones.
+type localLoader struct{}
+
+func (localLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	repo, err := git.PlainOpen(ep.Path)
+	if err == git.ErrRepositoryNotExists {
+		return nil, transport.ErrRepositoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repo.Storer, nil
+}
+
+// goBackend works in-process with go-git, without needing git installed.
+type goBackend struct{}
+
+// Clone can't make a partial clone, so sparse checkouts only save disk space.
+func (g goBackend) Clone(ctx context.Context, gitURL, ref, dir string, sparse []string) error {
+	if err := checkOnline(gitURL); err != nil {
+		return err
+	}
+	auth, err := goAuthMethod(gitURL)
+	if err != nil {
+		return fmt.Errorf("error authenticating to %s: %v", gitURL, err)
+	}
+	opts := &git.CloneOptions{
+		Auth:         auth,
+		URL:          gitURL,
+		Depth:        cloneDepth(gitURL),
+		SingleBranch: true,
+		Tags:         git.NoTags,
+		NoCheckout:   len(sparse) > 0,
+	}
+	if ref != "" {
+		name, err := g.remoteRefName(ctx, gitURL, ref)
+		if err != nil {
+			return err
+		}
+		opts.ReferenceName = name
+	}
+
+	if _, err := git.PlainCloneContext(ctx, dir, false, opts); err != nil {
+		return fmt.Errorf("error cloning %s: %w", gitURL, err)
+	}
+	if len(sparse) > 0 {
+		return g.SparseCheckout(ctx, dir, sparse)
+	}
+	return nil
+}
+
+// cloneDepth is 1 for a shallow clone, except for local repositories, which are
+// served in-process by a server without shallow clone support.
+func cloneDepth(gitURL string) int {
+	if ep, err := transport.NewEndpoint(gitURL); err == nil && ep.Protocol == "file" {
+		return 0
+	}
+	return 1
+}
+
+// remoteRefName tells whether ref is a branch or a tag of the remote, which go-git
+// needs to know before cloning it.
+func (g goBackend) remoteRefName(ctx context.Context, gitURL, ref string) (plumbing.ReferenceName, error) {
+	refs, err := g.ListRemote(ctx, gitURL)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(ref), plumbing.NewTagReferenceName(ref)} {
+		for _, r := range refs {
+			if r.Name == name.String() {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("remote branch or tag %s not found in %s", ref, gitURL)
+}
+
+// FetchCommit clones the whole history of the branch, since go-git can't fetch a
+// single commit or deepen a shallow clone, and falls back to every branch and tag.
+func (g goBackend) FetchCommit(ctx context.Context, gitURL, branch, commit, dir string, sparse []string) error {
+	if err := checkOnline(gitURL); err != nil {
+		return err
+	}
+	auth, err := goAuthMethod(gitURL)
+	if err != nil {
+		return fmt.Errorf("error authenticating to %s: %v", gitURL, err)
+	}
+	opts := &git.CloneOptions{
+		Auth:       auth,
+		URL:        gitURL,
+		NoCheckout: true,
+		Tags:       git.NoTags,
+	}
+	if branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(branch)
+		opts.SingleBranch = true
+	}
+
+	repo, err := git.PlainCloneContext(ctx, dir, false, opts)
+	if err != nil {
+		return fmt.Errorf("error cloning %s: %w", gitURL, err)
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(commit))
+	if err != nil {
+		// Last resort, the commit may be on another branch
+		err = repo.FetchContext(ctx, &git.FetchOptions{
+			Auth:     auth,
+			RefSpecs: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+			Tags:     git.AllTags,
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("error fetching %s: %w", gitURL, err)
+		}
+		if hash, err = repo.ResolveRevision(plumbing.Revision(commit)); err != nil {
+			return missingCommit(gitURL, branch, commit)
+		}
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	// Keep the branch checked out by name, so the clone is recognized as being on it
+	checkout := &git.CheckoutOptions{Hash: *hash, Force: true}
+	if branch != "" {
+		ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), *hash)
+		if err := repo.Storer.SetReference(ref); err != nil {
+			return err
+		}
+		checkout = &git.CheckoutOptions{Branch: ref.Name(), Force: true}
+	}
+	if len(sparse) > 0 {
+		// Only move HEAD, the sparse checkout fills in the working tree
+		checkout.Force, checkout.Keep = false, true
+	}
+	if err := worktree.Checkout(checkout); err != nil {
+		return err
+	}
+	if len(sparse) > 0 {
+		return g.SparseCheckout(ctx, dir, sparse)
+	}
+	return nil
+}
+
+func (goBackend) ResolveRef(repoDir, rev string) (string, error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return "", err
+	}
+
+	// go-git resolves commits only, so trees are looked up through their commit
+	base, tree := strings.CutSuffix(rev, "^{tree}")
+	hash, err := repo.ResolveRevision(plumbing.Revision(base))
+	if err != nil {
+		return "", err
+	}
+	if !tree {
+		return hash.String(), nil
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return "", err
+	}
+	return commit.TreeHash.String(), nil
+}
+
+func (goBackend) ReadFile(repoDir, rev, name string) ([]byte, error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := file.Contents()
+	return []byte(content), err
+}
+
+func (g goBackend) CloneHistory(ctx context.Context, gitURL, ref, dir string, depth int) error {
+	if err := checkOnline(gitURL); err != nil {
+		return err
+	}
+	auth, err := goAuthMethod(gitURL)
+	if err != nil {
+		return fmt.Errorf("error authenticating to %s: %v", gitURL, err)
+	}
+	if cloneDepth(gitURL) == 0 {
+		depth = 0
+	}
+	opts := &git.CloneOptions{
+		Auth:         auth,
+		URL:          gitURL,
+		Depth:        depth,
+		SingleBranch: true,
+		Tags:         git.NoTags,
+	}
+	if ref != "" {
+		name, err := g.remoteRefName(ctx, gitURL, ref)
+		if err != nil {
+			return err
+		}
+		opts.ReferenceName = name
+	}
+
+	if _, err := git.PlainCloneContext(ctx, dir, true, opts); err != nil {
+		return fmt.Errorf("error cloning %s: %w", gitURL, err)
+	}
+	return nil
+}
+
+func (goBackend) Log(repoDir, from, to string) ([]Commit, error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	fromCommit, err := repo.CommitObject(plumbing.NewHash(from))
+	if err != nil {
+		return nil, ErrNoHistory
+	}
+	toCommit, err := repo.CommitObject(plumbing.NewHash(to))
+	if err != nil {
+		return nil, ErrNoHistory
+	}
+	// A shallow clone may lack the commits joining them, which fails the search
+	if ancestor, err := fromCommit.IsAncestor(toCommit); err != nil || !ancestor {
+		return nil, ErrNoHistory
+	}
+
+	// Everything from already has is left out, including history merged in later
+	seen := map[plumbing.Hash]bool{}
+	ancestors := object.NewCommitPreorderIter(fromCommit, nil, nil)
+	ancestors.ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+
+	var commits []*object.Commit
+	err = object.NewCommitPreorderIter(toCommit, seen, nil).ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.After(commits[j].Committer.When)
+	})
+
+	var log []Commit
+	for _, c := range commits {
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		log = append(log, Commit{Hash: c.Hash.String(), Author: c.Author.Name, Subject: subject})
+	}
+	return log, nil
+}
+
+// ModifiedFiles compares the index with HEAD and the working tree by hand, as
+// go-git's status reports files next to the directories a sparse checkout skips
+// as deleted.
+func (goBackend) ModifiedFiles(repoDir string) ([]string, error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	committed := map[string]plumbing.Hash{}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Mode != filemode.Dir {
+			committed[name] = entry.Hash
+		}
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range idx.Entries {
+		hash, ok := committed[entry.Name]
+		delete(committed, entry.Name)
+		if !ok || hash != entry.Hash {
+			files = append(files, entry.Name)
+			continue
+		}
+		if entry.SkipWorktree {
+			continue
+		}
+		changed, err := changedOnDisk(repoDir, entry)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			files = append(files, entry.Name)
+		}
+	}
+	// Whatever is left was removed from the index
+	for name := range committed {
+		files = append(files, name)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// changedOnDisk reports whether the working tree copy of an index entry differs
+// from it. Files with the size and modification time the index recorded are
+// taken to be unchanged, like git does.
+func changedOnDisk(repoDir string, entry *index.Entry) (bool, error) {
+	file := filepath.Join(repoDir, filepath.FromSlash(entry.Name))
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var content []byte
+	switch entry.Mode {
+	case filemode.Submodule:
+		// Submodules that were never checked out aren't changes
+		sub, err := git.PlainOpen(file)
+		if err != nil {
+			return false, nil
+		}
+		subHead, err := sub.Head()
+		if err != nil {
+			return false, nil
+		}
+		return subHead.Hash() != entry.Hash, nil
+	case filemode.Symlink:
+		target, err := os.Readlink(file)
+		if err != nil {
+			return true, nil
+		}
+		content = []byte(target)
+	default:
+		if !info.Mode().IsRegular() {
+			return true, nil
+		}
+		if uint32(info.Size()) != entry.Size {
+			return true, nil
+		}
+		if info.ModTime().Equal(entry.ModifiedAt) {
+			return false, nil
+		}
+		if content, err = os.ReadFile(file); err != nil {
+			return false, err
+		}
+	}
+	return plumbing.ComputeHash(plumbing.BlobObject, content) != entry.Hash, nil
+}
+
+func (goBackend) ListRemote(ctx context.Context, gitURL string) ([]RemoteRef, error) {
+	if err := checkOnline(gitURL); err != nil {
+		return nil, err
+	}
+	auth, err := goAuthMethod(gitURL)
+	if err != nil {
+		return nil, fmt.Errorf("error authenticating to %s: %v", gitURL, err)
+	}
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{gitURL},
+	})
+	list, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth, PeelingOption: git.AppendPeeled})
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []RemoteRef
+	hashes := map[plumbing.ReferenceName]plumbing.Hash{}
+	for _, ref := range list {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+		hashes[ref.Name()] = ref.Hash()
+		refs = append(refs, RemoteRef{Name: ref.Name().String(), Hash: ref.Hash().String()})
+	}
+	// HEAD comes as a symbolic reference, git ls-remote shows the commit it points at
+	for _, ref := range list {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			if hash, ok := hashes[ref.Target()]; ok {
+				refs = append(refs, RemoteRef{Name: "HEAD", Hash: hash.String()})
+			}
+		}
+	}
+
+	// The in-process server doesn't advertise peeled tags, so local repositories
+	// would lock the tag object of an annotated tag instead of its commit
+	if ep, err := transport.NewEndpoint(gitURL); err == nil && ep.Protocol == "file" {
+		return peelLocalTags(ep.Path, refs)
+	}
+	return refs, nil
+}
+
+// peelLocalTags adds the commit of every annotated tag of a local repository,
+// suffixed by ^{} like git ls-remote does.
+func peelLocalTags(repoDir string, refs []RemoteRef) ([]RemoteRef, error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	peeled := refs
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref.Name, "refs/tags/") || strings.HasSuffix(ref.Name, "^{}") {
+			continue
+		}
+		hash := plumbing.NewHash(ref.Hash)
+		annotated := false
+		for {
+			tag, err := repo.TagObject(hash)
+			if err == plumbing.ErrObjectNotFound {
+				break // Not a tag object, which for a lightweight tag is the commit itself
+			}
+			if err != nil {
+				return nil, err
+			}
+			hash, annotated = tag.Target, true
+		}
+		if annotated {
+			peeled = append(peeled, RemoteRef{Name: ref.Name + "^{}", Hash: hash.String()})
+		}
+	}
+	return peeled, nil
+}
+
+func (goBackend) ReadHead(repoDir string) (GitRepo, error) {
+	repo := GitRepo{Path: repoDir}
+
+	r, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return repo, err
+	}
+
+	remote, err := r.Remote("origin")
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return repo, fmt.Errorf("error fetching repository URL: %v", err)
+	}
+	repo.URL = remote.Config().URLs[0]
+
+	// Clones fetched from a mirror record the URL they are known by, see recordURL
+	cfg, err := r.Config()
+	if err != nil {
+		return repo, err
+	}
+	if url := cfg.Raw.Section("gogetty").Option("url"); url != "" {
+		repo.URL = url
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return repo, fmt.Errorf("error fetching latest commit: %v", err)
+	}
+	// A detached HEAD, as left by cloning a tag, isn't on any branch
+	if head.Name().IsBranch() {
+		repo.Branch = head.Name().Short()
+	}
+	repo.Commit = head.Hash().String()
+
+	return repo, nil
+}
+
+// UpdateSubmodules recurses by hand, so each submodule is fetched with the
+// credentials of its own host.
+func (goBackend) UpdateSubmodules(ctx context.Context, repoDir string) error {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return err
+	}
+	return updateSubmodules(ctx, repo)
+}
+
+func updateSubmodules(ctx context.Context, repo *git.Repository) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return err
+	}
+	for _, submodule := range submodules {
+		// Update initializes the submodule from its config, so rewriting it is enough
+		url := RewriteURL(submodule.Config().URL)
+		submodule.Config().URL = url
+		if err := checkOnline(url); err != nil {
+			return err
+		}
+		auth, err := goAuthMethod(url)
+		if err != nil {
+			return fmt.Errorf("error authenticating to %s: %v", url, err)
+		}
+		if err := submodule.UpdateContext(ctx, &git.SubmoduleUpdateOptions{Init: true, Auth: auth}); err != nil {
+			return err
+		}
+		subRepo, err := submodule.Repository()
+		if err != nil {
+			return err
+		}
+		if err := updateSubmodules(ctx, subRepo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (goBackend) PullLFS(ctx context.Context, repoDir string) error {
+	return fmt.Errorf("the %s git backend doesn't support Git LFS, install git and Git LFS and use the %s backend", BackendGo, BackendExec)
+}
+
+// SparseCheckout records the directories the way git does, so clones can be
+// shared with the exec backend.
+func (goBackend) SparseCheckout(ctx context.Context, repoDir string, dirs []string) error {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return err
+	}
+
+	// go-git can't download the blobs a partial clone left out
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	if cfg.Raw.Section("remote").Subsection("origin").Option("promisor") == "true" {
+		return fmt.Errorf("it is a partial clone made by git, which the %s backend can't check out more of; use the %s backend, or delete it so it is cloned again", BackendGo, BackendExec)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	// Resetting a sparse index makes go-git drop the skipped entries, so the whole
+	// tree is checked out before leaving anything out
+	if err := worktree.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.MixedReset}); err != nil {
+		return err
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset}); err != nil {
+		return err
+	}
+
+	if len(dirs) > 0 {
+		commit, err := repo.CommitObject(head.Hash())
+		if err != nil {
+			return err
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return err
+		}
+		patterns, err := conePatterns(tree, dirs)
+		if err != nil {
+			return err
+		}
+
+		idx, err := repo.Storer.Index()
+		if err != nil {
+			return err
+		}
+		for _, entry := range idx.Entries {
+			if matchesPattern(entry.Name, patterns) {
+				continue
+			}
+			entry.SkipWorktree = true
+			if err := removeFile(repoDir, entry.Name); err != nil {
+				return err
+			}
+		}
+		// Version 2 indexes can't hold the skip-worktree bit
+		if idx.Version < 3 {
+			idx.Version = 3
+		}
+		if err := repo.Storer.SetIndex(idx); err != nil {
+			return err
+		}
+	}
+
+	return writeSparseState(repoDir, dirs)
+}
+
+// removeFile removes a file of the working tree along with the directories it leaves empty.
+func removeFile(repoDir, name string) error {
+	file := filepath.Join(repoDir, filepath.FromSlash(name))
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(file); dir != repoDir; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func matchesPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if name == pattern || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(name, pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// conePatterns lists the directories, ending in a slash, and files a sparse
+// checkout keeps in git's cone mode, which also keeps the files next to each
+// directory and its parents.
+func conePatterns(tree *object.Tree, dirs []string) ([]string, error) {
+	var patterns []string
+	parents := map[string]bool{".": true}
+	for _, dir := range dirs {
+		patterns = append(patterns, dir+"/")
+		for parent := path.Dir(dir); !parents[parent]; parent = path.Dir(parent) {
+			parents[parent] = true
+		}
+	}
+
+	for parent := range parents {
+		parentTree := tree
+		if parent != "." {
+			t, err := tree.Tree(parent)
+			if err == object.ErrDirectoryNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			parentTree = t
+		}
+		for _, entry := range parentTree.Entries {
+			if entry.Mode.IsFile() {
+				patterns = append(patterns, path.Join(parent, entry.Name))
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// gitConfigFiles are the config files git reads sparse checkout settings from.
+// Once git has enabled per worktree config, it writes them to the second one.
+func gitConfigFiles(repoDir string) []string {
+	return []string{
+		filepath.Join(repoDir, ".git", "config"),
+		filepath.Join(repoDir, ".git", "config.worktree"),
+	}
+}
+
+func sparseFilePath(repoDir string) string {
+	return filepath.Join(repoDir, ".git", "info", "sparse-checkout")
+}
+
+// writeSparseState writes the sparse-checkout file and config git reads in cone mode.
+func writeSparseState(repoDir string, dirs []string) error {
+	enabled := strconv.FormatBool(len(dirs) > 0)
+	for i, file := range gitConfigFiles(repoDir) {
+		cfg := format.New()
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) && i > 0 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := format.NewDecoder(bytes.NewReader(data)).Decode(cfg); err != nil {
+			return err
+		}
+
+		core := cfg.Section("core")
+		core.SetOption("sparseCheckout", enabled)
+		core.SetOption("sparseCheckoutCone", "true")
+
+		var out bytes.Buffer
+		if err := format.NewEncoder(&out).Encode(cfg); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, out.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+
+	if len(dirs) == 0 {
+		if err := os.Remove(sparseFilePath(repoDir)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	// Each parent directory keeps its own files but not its other subdirectories
+	lines := []string{"/*", "!/*/"}
+	written := map[string]bool{}
+	sorted := append([]string{}, dirs...)
+	sort.Strings(sorted)
+	for _, dir := range sorted {
+		parts := strings.Split(dir, "/")
+		for i := 1; i < len(parts); i++ {
+			parent := strings.Join(parts[:i], "/")
+			if !written[parent] {
+				lines = append(lines, "/"+parent+"/", "!/"+parent+"/*/")
+				written[parent] = true
+			}
+		}
+		lines = append(lines, "/"+dir+"/")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(sparseFilePath(repoDir)), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(sparseFilePath(repoDir), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func (goBackend) SparseDirectories(repoDir string) ([]string, bool, error) {
+	// The last config file setting the option wins
+	enabled := false
+	for _, file := range gitConfigFiles(repoDir) {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		cfg := format.New()
+		if err := format.NewDecoder(bytes.NewReader(data)).Decode(cfg); err != nil {
+			return nil, false, err
+		}
+		if value := cfg.Section("core").Option("sparseCheckout"); value != "" {
+			enabled = strings.EqualFold(value, "true")
+		}
+	}
+	if !enabled {
+		return nil, false, nil
+	}
+
+	data, err := os.ReadFile(sparseFilePath(repoDir))
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Parents are followed by a pattern excluding their subdirectories, the rest are kept whole
+	var dirs []string
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if line == "/*" || !strings.HasPrefix(line, "/") || !strings.HasSuffix(line, "/") {
+			continue
+		}
+		if i+1 < len(lines) && lines[i+1] == "!"+line+"*/" {
+			continue
+		}
+		dirs = append(dirs, strings.Trim(line, "/"))
+	}
+	return dirs, true, nil
+}
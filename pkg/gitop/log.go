@@ -0,0 +1,84 @@
+package gitop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Commit is a commit as a log shows it.
+type Commit struct {
+	Hash    string
+	Author  string
+	Subject string
+}
+
+// ErrNoHistory is returned by Log when the clone doesn't have the history that
+// joins the two commits, as shallow clones usually don't.
+var ErrNoHistory = errors.New("history not available")
+
+// Log returns the commits that to has and from doesn't, newest first. from must
+// be an ancestor of to.
+func Log(repoDir, from, to string) ([]Commit, error) {
+	commits, err := backend.Log(repoDir, from, to)
+	if err != nil && !errors.Is(err, ErrNoHistory) {
+		return nil, fmt.Errorf("error reading the log of %s: %v", repoDir, err)
+	}
+	return commits, err
+}
+
+// historyDepths are the depths of history cloned in turn by FetchLog, ending with
+// all of it.
+var historyDepths = []int{50, 500, 0}
+
+// FetchLog returns the commits between from and to, see Log, cloning the history
+// of ref for it. ref is a branch or tag whose history holds to, or empty for the
+// default branch. Only the commits are cloned, into a temporary directory.
+func FetchLog(ctx context.Context, gitURL string, mirrors []string, ref, from, to string) ([]Commit, error) {
+	var commits []Commit
+	err := fromSources(ctx, gitURL, mirrors, func(source string) error {
+		for _, depth := range historyDepths {
+			done, err := logAtDepth(ctx, source, ref, from, to, depth, &commits)
+			if err != nil || done {
+				return err
+			}
+		}
+		return fmt.Errorf("%w: %s isn't an ancestor of %s", ErrNoHistory, shortSHA(from), shortSHA(to))
+	})
+	return commits, err
+}
+
+// logAtDepth clones depth commits of history, and reports whether they were
+// enough for the log.
+func logAtDepth(ctx context.Context, gitURL, ref, from, to string, depth int, commits *[]Commit) (bool, error) {
+	dir, err := os.MkdirTemp("", "gogetty-log-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+
+	err = withRetry(ctx, network.CloneTimeout, func(ctx context.Context) error {
+		// Each attempt starts over in an empty directory
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		return backend.CloneHistory(ctx, gitURL, ref, dir, depth)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	*commits, err = Log(dir, from, to)
+	if errors.Is(err, ErrNoHistory) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func shortSHA(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
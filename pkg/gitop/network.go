@@ -0,0 +1,123 @@
+package gitop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// NetworkOptions bounds the git operations that talk to a remote. A timeout of
+// zero leaves that kind of operation unbounded.
+type NetworkOptions struct {
+	CloneTimeout    time.Duration // Each attempt at cloning a repository
+	ListTimeout     time.Duration // Each attempt at listing a remote's tags
+	PopulateTimeout time.Duration // Each attempt at widening a checkout, or fetching submodules or LFS objects
+	Retries         int           // Attempts made after the first fails for a transient reason
+	RetryDelay      time.Duration // Wait before the first retry, doubled before each one after it
+}
+
+// DefaultNetworkOptions are used for the options the user doesn't set.
+var DefaultNetworkOptions = NetworkOptions{
+	CloneTimeout:    10 * time.Minute,
+	ListTimeout:     time.Minute,
+	PopulateTimeout: 30 * time.Minute,
+	Retries:         2,
+	RetryDelay:      2 * time.Second,
+}
+
+var network = DefaultNetworkOptions
+
+// UseNetwork sets the timeouts and retries of every remote operation.
+func UseNetwork(opts NetworkOptions) {
+	network = opts
+}
+
+// withRetry runs op with the timeout, trying again after transient failures such
+// as dropped connections or timeouts. Each attempt must start from scratch. It
+// gives up at once when ctx is done, which is how Ctrl-C ends a fetch.
+func withRetry(ctx context.Context, timeout time.Duration, op func(ctx context.Context) error) error {
+	delay := network.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := attemptWithTimeout(ctx, timeout, op)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= network.Retries || !transient(err) {
+			if attempt > 0 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func attemptWithTimeout(ctx context.Context, timeout time.Duration, op func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return op(ctx)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := op(attemptCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %v", errTimeout, timeout)
+	}
+	return err
+}
+
+var errTimeout = errors.New("timed out")
+
+// transientMessages are the parts of git and go-git errors that point at the
+// network or an overloaded server rather than at the request itself.
+var transientMessages = []string{
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"connection timed out",
+	"connection reset",
+	"connection refused",
+	"operation timed out",
+	"i/o timeout",
+	"tls handshake timeout",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"rpc failed",
+	"unexpected eof",
+	"broken pipe",
+}
+
+// Such as git's "returned error: 503" and go-git's "status code: 503"
+var serverError = regexp.MustCompile(`(error|code): (429|50[234])\b`)
+
+// transient reports whether an error is worth retrying.
+func transient(err error) bool {
+	if errors.Is(err, ErrOffline) {
+		return false
+	}
+	if errors.Is(err, errTimeout) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, transient := range transientMessages {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return serverError.MatchString(msg)
+}
@@ -0,0 +1,30 @@
+package gitop
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrOffline is returned by every operation that would need the network while
+// working offline.
+var ErrOffline = errors.New("working offline")
+
+var offline bool
+
+// UseOffline turns off, or back on, every git operation that talks to a remote.
+func UseOffline(on bool) {
+	offline = on
+}
+
+// Offline reports whether remotes are out of reach, see UseOffline.
+func Offline() bool {
+	return offline
+}
+
+// checkOnline fails when working offline, before gitURL is contacted.
+func checkOnline(gitURL string) error {
+	if offline {
+		return fmt.Errorf("%w, %s can't be reached", ErrOffline, gitURL)
+	}
+	return nil
+}
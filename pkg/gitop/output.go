@@ -0,0 +1,14 @@
+package gitop
+
+import (
+	"io"
+	"os"
+)
+
+var output io.Writer = os.Stdout
+
+// UseOutput sends the messages printed while cloning and linking to w, such as a
+// progress display that keeps them apart from the lines it redraws.
+func UseOutput(w io.Writer) {
+	output = w
+}
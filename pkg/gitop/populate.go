@@ -0,0 +1,243 @@
+package gitop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// PopulateOptions selects the parts of a repository that a clone leaves out.
+type PopulateOptions struct {
+	Directories []string // Directories that must be checked out, or none for the whole tree
+	Submodules  bool
+	LFS         bool
+}
+
+// Populate widens a sparse checkout to the directories needed, and fills in the
+// submodules and Git LFS objects of a clone. Each step is skipped when there is
+// nothing to fetch, so populating a clone again is cheap.
+func Populate(ctx context.Context, repoDir string, opts PopulateOptions) error {
+	if err := widenSparseCheckout(ctx, repoDir, opts.Directories); err != nil {
+		return fmt.Errorf("error updating the sparse checkout of %s: %v", repoDir, err)
+	}
+
+	if opts.Submodules {
+		update, err := needsSubmodules(repoDir)
+		if err != nil {
+			return err
+		}
+		if update {
+			err := withRetry(ctx, network.PopulateTimeout, func(ctx context.Context) error {
+				return backend.UpdateSubmodules(ctx, repoDir)
+			})
+			if err != nil {
+				return fmt.Errorf("error updating submodules of %s: %v", repoDir, err)
+			}
+		}
+	}
+
+	if opts.LFS {
+		pointers, err := FindLFSPointers(repoDir)
+		if err != nil {
+			return err
+		}
+		if len(pointers) > 0 {
+			err := withRetry(ctx, network.PopulateTimeout, func(ctx context.Context) error {
+				return backend.PullLFS(ctx, repoDir)
+			})
+			if err != nil {
+				return fmt.Errorf("error pulling Git LFS objects of %s: %v", repoDir, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// needsSubmodules reports whether the submodules of a clone are to be updated.
+// Updating checks them against the remote, so offline only empty ones are.
+func needsSubmodules(repoDir string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(repoDir, ".gitmodules")); err != nil {
+		return false, nil
+	}
+	if !offline {
+		return true, nil
+	}
+	empty, err := FindEmptySubmodules(repoDir)
+	return len(empty) > 0, err
+}
+
+// widenSparseCheckout makes sure a sparse checkout includes dirs, checking out the
+// whole tree when there are none. Clones are shared between projects, so the
+// sparse set only ever grows.
+func widenSparseCheckout(ctx context.Context, repoDir string, dirs []string) error {
+	current, sparse, err := backend.SparseDirectories(repoDir)
+	if err != nil || !sparse {
+		return err
+	}
+
+	if len(dirs) == 0 {
+		if err := sparseCheckout(ctx, repoDir, nil); err != nil {
+			return err
+		}
+		rewriteGodotPaths(repoDir)
+		return nil
+	}
+
+	// Files checked out along with their directory are already there
+	var needed []string
+	for _, dir := range dirs {
+		if info, err := os.Stat(filepath.Join(repoDir, filepath.FromSlash(dir))); err == nil && !info.IsDir() {
+			continue
+		}
+		needed = append(needed, dir)
+	}
+
+	// Cone mode keeps the files next to every selected path, so a file that was
+	// selected shows up once its parent's files are checked out
+	want := mergeDirectories(current, needed)
+	if len(want) == len(current) {
+		return nil
+	}
+	if err := sparseCheckout(ctx, repoDir, want); err != nil {
+		return err
+	}
+	rewriteGodotPaths(repoDir)
+	return nil
+}
+
+// sparseCheckout changes a sparse checkout, which downloads the files a partial
+// clone left out.
+func sparseCheckout(ctx context.Context, repoDir string, dirs []string) error {
+	return withRetry(ctx, network.PopulateTimeout, func(ctx context.Context) error {
+		return backend.SparseCheckout(ctx, repoDir, dirs)
+	})
+}
+
+// mergeDirectories adds the directories in extra that current doesn't have yet.
+func mergeDirectories(current, extra []string) []string {
+	merged := append([]string{}, current...)
+	seen := map[string]bool{}
+	for _, dir := range current {
+		seen[dir] = true
+	}
+	for _, dir := range extra {
+		dir = strings.Trim(path.Clean(filepath.ToSlash(dir)), "/")
+		if dir == "" || dir == "." || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		merged = append(merged, dir)
+	}
+	return merged
+}
+
+// lfsPointerPrefix starts every Git LFS pointer file, which are all smaller than
+// lfsPointerMaxSize.
+const (
+	lfsPointerPrefix  = "version https://git-lfs.github.com/spec/v1\n"
+	lfsPointerMaxSize = 1024
+)
+
+// FindLFSPointers lists the files in repoDir that are Git LFS pointers rather
+// than the content they point to, relative to repoDir.
+func FindLFSPointers(repoDir string) ([]string, error) {
+	var pointers []string
+
+	err := filepath.Walk(repoDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() || info.Size() > lfsPointerMaxSize {
+			return nil
+		}
+
+		pointer, err := isLFSPointer(path)
+		if err != nil {
+			return err
+		}
+		if pointer {
+			rel, err := filepath.Rel(repoDir, path)
+			if err != nil {
+				return err
+			}
+			pointers = append(pointers, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	return pointers, err
+}
+
+func isLFSPointer(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	prefix := make([]byte, len(lfsPointerPrefix))
+	if _, err := io.ReadFull(file, prefix); err != nil {
+		// Files shorter than the prefix can't be pointers
+		return false, nil
+	}
+	return bytes.Equal(prefix, []byte(lfsPointerPrefix)), nil
+}
+
+// FindEmptySubmodules lists the submodules of repoDir that were never
+// initialized, which leaves their directories empty. Submodules outside a sparse
+// checkout are left out, their directories are empty on purpose.
+func FindEmptySubmodules(repoDir string) ([]string, error) {
+	cfg, err := ini.Load(filepath.Join(repoDir, ".gitmodules"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	dirs, sparse, err := backend.SparseDirectories(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var empty []string
+	for _, section := range cfg.Sections() {
+		path := section.Key("path").String()
+		if !strings.HasPrefix(section.Name(), "submodule ") || path == "" {
+			continue
+		}
+		if sparse && !sparseIncludes(dirs, path) {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(repoDir, filepath.FromSlash(path)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			empty = append(empty, path)
+		}
+	}
+	return empty, nil
+}
+
+// sparseIncludes reports whether a sparse checkout of dirs checks out the
+// directory at path, or part of it.
+func sparseIncludes(dirs []string, path string) bool {
+	path = strings.Trim(path, "/")
+	for _, dir := range dirs {
+		if dir == path || strings.HasPrefix(path, dir+"/") || strings.HasPrefix(dir, path+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package gitop
+
+import (
+	"fmt"
+)
+
+// ResolveHead returns the full SHA of the commit checked out in repoDir.
+func ResolveHead(repoDir string) (string, error) {
+	return revParse(repoDir, "HEAD")
+}
+
+// TreeHash returns the hash of the tree checked out in repoDir. It identifies the
+// content of the commit independently of where the clone lives on disk.
+func TreeHash(repoDir string) (string, error) {
+	return revParse(repoDir, "HEAD^{tree}")
+}
+
+// ModifiedFiles returns the tracked files changed in the working tree or index
+// of repoDir, such as edits made to a module in the cache. Godot scripts whose
+// only changes are the paths Fetch rewrote are left out.
+func ModifiedFiles(repoDir string) ([]string, error) {
+	files, err := backend.ModifiedFiles(repoDir)
+	if err != nil {
+		return nil, fmt.Errorf("error checking %s for changes: %v", repoDir, err)
+	}
+
+	var modified []string
+	for _, file := range files {
+		if !onlyPathsRewritten(repoDir, file) {
+			modified = append(modified, file)
+		}
+	}
+	return modified, nil
+}
+
+func revParse(repoDir, rev string) (string, error) {
+	out, err := backend.ResolveRef(repoDir, rev)
+	if err != nil {
+		return "", fmt.Errorf("error resolving %s in %s: %v", rev, repoDir, err)
+	}
+	return out, nil
+}
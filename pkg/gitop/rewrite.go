@@ -0,0 +1,103 @@
+package gitop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+)
+
+// Rewrite replaces the start of repository URLs like git's url.<base>.insteadOf,
+// so manifests can name public URLs while a build machine uses a mirror.
+type Rewrite struct {
+	URL       string `json:"url"`       // Replacement, e.g. https://git.internal/github/
+	InsteadOf string `json:"insteadOf"` // Prefix being replaced, e.g. https://github.com/
+}
+
+var rewrites []Rewrite
+
+// UseRewrites sets the rules RewriteURL applies.
+func UseRewrites(rules []Rewrite) error {
+	for _, rule := range rules {
+		if rule.URL == "" || rule.InsteadOf == "" {
+			return fmt.Errorf("URL rewrite rules need both \"url\" and \"insteadOf\"")
+		}
+	}
+	rewrites = rules
+	return nil
+}
+
+// RewriteURL applies the rule with the longest matching prefix, as git does.
+func RewriteURL(gitURL string) string {
+	best := -1
+	for i, rule := range rewrites {
+		if strings.HasPrefix(gitURL, rule.InsteadOf) && (best < 0 || len(rule.InsteadOf) > len(rewrites[best].InsteadOf)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return gitURL
+	}
+	return rewrites[best].URL + strings.TrimPrefix(gitURL, rewrites[best].InsteadOf)
+}
+
+// sources lists the URLs a repository is tried from in turn: its own, then each of
+// its mirrors, all rewritten.
+func sources(gitURL string, mirrors []string) []string {
+	var urls []string
+	for _, u := range append([]string{gitURL}, mirrors...) {
+		u = RewriteURL(u)
+		seen := false
+		for _, v := range urls {
+			seen = seen || SameURL(u, v)
+		}
+		if !seen {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// fromSources calls fn with each source until one succeeds, and otherwise returns
+// every failure.
+func fromSources(ctx context.Context, gitURL string, mirrors []string, fn func(source string) error) error {
+	urls := sources(gitURL, mirrors)
+	var failures []string
+	for _, source := range urls {
+		err := fn(source)
+		if err == nil {
+			return nil
+		}
+		// Cancelling stops the search too, there's no use trying the other sources
+		if len(urls) == 1 || ctx.Err() != nil {
+			return err
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", source, err))
+	}
+	return fmt.Errorf("every source failed:\n  %s", strings.Join(failures, "\n  "))
+}
+
+// recordURL stores the URL a clone is known by, when it was fetched from another
+// one. The origin keeps pointing at the source, which later fetches still use.
+func recordURL(repoDir, gitURL string) error {
+	file := filepath.Join(repoDir, ".git", "config")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	cfg := format.New()
+	if err := format.NewDecoder(bytes.NewReader(data)).Decode(cfg); err != nil {
+		return err
+	}
+	cfg.Section("gogetty").SetOption("url", gitURL)
+
+	var out bytes.Buffer
+	if err := format.NewEncoder(&out).Encode(cfg); err != nil {
+		return err
+	}
+	return os.WriteFile(file, out.Bytes(), 0644)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func Scan(directory string) ([]GitRepo, error) {
@@ -14,6 +15,10 @@ func Scan(directory string) ([]GitRepo, error) {
 			fmt.Printf("Error encountered while walking through directory: %v\n", err)
 			return err
 		}
+		// Clones still being written by Fetch aren't part of the cache yet
+		if info.IsDir() && strings.HasPrefix(info.Name(), tmpPrefix) {
+			return filepath.SkipDir
+		}
 		if info.IsDir() && info.Name() == ".git" {
 			repoPath := filepath.Dir(path) // Get the path of the repository
 
@@ -0,0 +1,133 @@
+package gitop
+
+import (
+	"context"
+	"fmt"
+	"gogetty/pkg/semver"
+	"strings"
+)
+
+type Tag struct {
+	Name   string
+	Commit string // SHA of the tagged commit, peeled for annotated tags
+}
+
+// Remote is what a remote repository advertises.
+type Remote struct {
+	Head     string            // Commit at the tip of the default branch
+	Branches map[string]string // Commit at the tip of each branch
+	Tags     []Tag
+}
+
+// Tip returns the commit at the tip of a branch, or of the default branch when
+// branch is empty.
+func (r Remote) Tip(branch string) (string, bool) {
+	if branch == "" {
+		return r.Head, r.Head != ""
+	}
+	commit, ok := r.Branches[branch]
+	return commit, ok
+}
+
+// QueryRemote lists the branches and tags of a remote repository without cloning
+// it, from the first of its URL and mirrors that answers.
+func QueryRemote(ctx context.Context, gitURL string, mirrors []string) (Remote, error) {
+	var refs []RemoteRef
+	err := fromSources(ctx, gitURL, mirrors, func(source string) error {
+		return withRetry(ctx, network.ListTimeout, func(ctx context.Context) error {
+			var err error
+			refs, err = backend.ListRemote(ctx, source)
+			return err
+		})
+	})
+	if err != nil {
+		return Remote{}, fmt.Errorf("error listing %s: %v", gitURL, err)
+	}
+
+	remote := Remote{Branches: map[string]string{}}
+	index := map[string]int{}
+	for _, ref := range refs {
+		if ref.Name == "HEAD" {
+			remote.Head = ref.Hash
+			continue
+		}
+		if branch, ok := strings.CutPrefix(ref.Name, "refs/heads/"); ok {
+			remote.Branches[branch] = ref.Hash
+			continue
+		}
+		if !strings.HasPrefix(ref.Name, "refs/tags/") {
+			continue
+		}
+		name := strings.TrimPrefix(ref.Name, "refs/tags/")
+		peeled := strings.HasSuffix(name, "^{}")
+		name = strings.TrimSuffix(name, "^{}")
+
+		if i, ok := index[name]; ok {
+			// The peeled ref points at the commit rather than the tag object
+			if peeled {
+				remote.Tags[i].Commit = ref.Hash
+			}
+			continue
+		}
+		index[name] = len(remote.Tags)
+		remote.Tags = append(remote.Tags, Tag{Name: name, Commit: ref.Hash})
+	}
+
+	return remote, nil
+}
+
+// ListTags lists the tags of a remote repository, see QueryRemote.
+func ListTags(ctx context.Context, gitURL string, mirrors []string) ([]Tag, error) {
+	remote, err := QueryRemote(ctx, gitURL, mirrors)
+	if err != nil {
+		return nil, err
+	}
+	return remote.Tags, nil
+}
+
+// ResolveVersion picks the highest tag of the remote repository that satisfies the
+// given version constraint. Tags that aren't semantic versions are ignored.
+func ResolveVersion(ctx context.Context, gitURL string, mirrors []string, constraint string) (Tag, error) {
+	c, err := semver.ParseConstraint(constraint)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	tags, err := ListTags(ctx, gitURL, mirrors)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	return MatchVersion(c, tags)
+}
+
+// MatchVersion picks the highest of the given tags that satisfies the constraint.
+func MatchVersion(c semver.Constraint, tags []Tag) (Tag, error) {
+	var versions []semver.Version
+	byVersion := map[string]Tag{}
+	for _, tag := range tags {
+		v, err := semver.Parse(tag.Name)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+		byVersion[v.Original] = tag
+	}
+
+	best, ok := c.Highest(versions)
+	if !ok {
+		return Tag{}, fmt.Errorf("no tag satisfies version %s", c)
+	}
+	return byVersion[best.Original], nil
+}
+
+// LatestVersion picks the highest of the given tags that is a release, leaving
+// out pre-releases and tags that aren't semantic versions.
+func LatestVersion(tags []Tag) (Tag, bool) {
+	c, err := semver.ParseConstraint(">=0.0.0")
+	if err != nil {
+		return Tag{}, false
+	}
+	tag, err := MatchVersion(c, tags)
+	return tag, err == nil
+}
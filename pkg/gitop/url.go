@@ -0,0 +1,51 @@
+package gitop
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// NormalizeURL reduces the different spellings of a repository URL to one form,
+// so that "https://GitHub.com/owner/repo.git/" and "https://github.com/owner/repo"
+// are recognized as the same repository. scp-like URLs such as
+// "git@github.com:owner/repo.git" are rewritten to their ssh:// form.
+func NormalizeURL(gitURL string) string {
+	s := strings.TrimSpace(gitURL)
+
+	if !strings.Contains(s, "://") {
+		// scp-like syntax: [user@]host:path
+		if at := strings.Index(s, ":"); at > 0 && !strings.ContainsAny(s[:at], `/\`) && len(s[:at]) > 1 {
+			s = "ssh://" + s[:at] + "/" + strings.TrimPrefix(s[at+1:], "/")
+		}
+	}
+
+	if parsed, err := url.Parse(s); err == nil && parsed.Scheme != "" {
+		parsed.Scheme = strings.ToLower(parsed.Scheme)
+		parsed.Host = strings.ToLower(parsed.Host)
+		s = parsed.String()
+	}
+
+	s = strings.TrimRight(s, "/")
+	s = strings.TrimSuffix(s, ".git")
+	return strings.TrimRight(s, "/")
+}
+
+// SameURL reports whether two URLs point at the same repository.
+func SameURL(a, b string) bool {
+	return NormalizeURL(a) == NormalizeURL(b)
+}
+
+// SameCommit compares two possibly abbreviated commit SHAs.
+func SameCommit(a, b string) bool {
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// ModuleKey returns the cache directory name of a repository at a commit. It is
+// derived from the normalized URL and the commit, so every version of every
+// repository gets its own clone, and keeps the repository name for readability.
+func ModuleKey(name, gitURL, commit string) string {
+	sum := sha256.Sum256([]byte(NormalizeURL(gitURL) + "\n" + commit))
+	return name + "-" + hex.EncodeToString(sum[:])[:16]
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"gopkg.in/ini.v1"
 )
@@ -63,23 +64,44 @@ func getUserDirPath(dirName string) string {
 }
 
 func UpdateProjectPaths(project GodotProject) error {
-	fmt.Println("parsing godot scripts")
+	var failed []string
 	for _, script := range project.Scripts {
-		fmt.Printf("parsing: %v\n", script)
 		err := parseScriptPaths(&script, project)
 		if err != nil {
-			fmt.Println("Godot Script failed to parse: ", filepath.Base(script.Path))
+			failed = append(failed, filepath.Base(script.Path))
 		}
 	}
+	if len(failed) > 0 {
+		return fmt.Errorf("godot scripts failed to parse: %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
 func GetGodotProject(dirPath string) (*GodotProject, error) {
-	fmt.Println("Getting godot project")
+	godotProject, err := ReadProjectSettings(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk the project directory to generate script lists
+	gdScripts, csScripts, err := walkProjectDirectory(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Append the script lists to the GodotProject's Scripts field
+	godotProject.Scripts = append(godotProject.Scripts, gdScripts...)
+	godotProject.Scripts = append(godotProject.Scripts, csScripts...)
+
+	return godotProject, nil
+}
+
+// ReadProjectSettings reads the project.godot file in dirPath, without looking
+// for the project's scripts.
+func ReadProjectSettings(dirPath string) (*GodotProject, error) {
 	projectFilePath := filepath.Join(dirPath, "project.godot")
 	cfg, err := ini.Load(projectFilePath)
 	if err != nil {
-		fmt.Println("Failed to find project!")
 		return nil, err
 	}
 
@@ -102,16 +124,5 @@ func GetGodotProject(dirPath string) (*GodotProject, error) {
 	// Set user directory based on the parsed values
 	godotProject.SetUserDirectory()
 
-	// Walk the project directory to generate script lists
-	gdScripts, csScripts, err := walkProjectDirectory(dirPath)
-	if err != nil {
-		return nil, err
-	}
-
-	// Append the script lists to the GodotProject's Scripts field
-	godotProject.Scripts = append(godotProject.Scripts, gdScripts...)
-	godotProject.Scripts = append(godotProject.Scripts, csScripts...)
-	fmt.Printf("Project found and parsed: %v\n", godotProject)
-
 	return &godotProject, nil
 }
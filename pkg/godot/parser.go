@@ -2,6 +2,7 @@ package godot
 
 import (
 	"bufio"
+	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
@@ -46,16 +47,8 @@ func parseScriptPaths(script *GodotScript, project GodotProject) error {
 	var modifiedLines []string
 
 	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Replace "res://" paths with projectDir
-		line = strings.ReplaceAll(line, "res:/", project.Path)
-
-		// Replace "user://" paths with the UserDirectory
-		line = strings.ReplaceAll(line, "user:/", project.UserDirectory)
-
 		// Append the modified line to the result
-		modifiedLines = append(modifiedLines, line)
+		modifiedLines = append(modifiedLines, rewriteLine(scanner.Text(), project))
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -79,3 +72,28 @@ func parseScriptPaths(script *GodotScript, project GodotProject) error {
 
 	return nil
 }
+
+// RewriteScript returns a script's content with its paths rewritten the way
+// UpdateProjectPaths rewrites them on disk.
+func RewriteScript(content []byte, project GodotProject) []byte {
+	var b strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		b.WriteString(rewriteLine(scanner.Text(), project) + "\n")
+	}
+	return []byte(b.String())
+}
+
+// IsScript reports whether UpdateProjectPaths rewrites the file at path.
+func IsScript(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".gd" || ext == ".cs"
+}
+
+func rewriteLine(line string, project GodotProject) string {
+	// Replace "res://" paths with projectDir
+	line = strings.ReplaceAll(line, "res:/", project.Path)
+
+	// Replace "user://" paths with the UserDirectory
+	return strings.ReplaceAll(line, "user:/", project.UserDirectory)
+}
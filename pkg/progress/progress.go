@@ -0,0 +1,167 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// State is the step a dependency is at.
+type State string
+
+const (
+	Cloning     State = "cloning"
+	Downloading State = "downloading"
+	CheckingOut State = "checking out"
+	Linking     State = "linking"
+	Done        State = "done"
+	Failed      State = "failed"
+	Stopped     State = "stopped" // Still in progress when another dependency failed
+)
+
+// Progress shows the state of every dependency being fetched. On a terminal the
+// lines are redrawn in place as dependencies move along, otherwise each change is
+// printed on a line of its own so logs stay readable. A nil Progress shows nothing,
+// and it is safe to update from several goroutines.
+//
+// Dependencies are told apart by a key, such as their normalized URL, since two
+// modules from different URLs may share a name.
+type Progress struct {
+	out  io.Writer
+	live bool
+
+	mu     sync.Mutex
+	keys   []string
+	names  map[string]string // Shown for each key
+	states map[string]State
+	drawn  int // Lines drawn so far, which a redraw moves back over
+}
+
+// New returns a Progress writing to stdout.
+func New() *Progress {
+	return &Progress{
+		out:    os.Stdout,
+		live:   isTerminal(os.Stdout),
+		names:  map[string]string{},
+		states: map[string]State{},
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Update moves the dependency with the given key to a new state, adding it under
+// name the first time it is seen.
+func (p *Progress) Update(key, name string, state State) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if old, ok := p.states[key]; ok && old == state {
+		return
+	}
+	if _, ok := p.states[key]; !ok {
+		p.keys = append(p.keys, key)
+		p.names[key] = name
+	}
+	p.states[key] = state
+
+	if !p.live {
+		fmt.Fprintf(p.out, "%s: %s\n", p.label(key), state)
+		return
+	}
+	p.redraw()
+}
+
+// label returns the name shown for a key, followed by the key itself when
+// another dependency has the same name.
+func (p *Progress) label(key string) string {
+	for _, other := range p.keys {
+		if other != key && p.names[other] == p.names[key] {
+			return p.names[key] + " (" + key + ")"
+		}
+	}
+	return p.names[key]
+}
+
+// Finish settles every dependency that is still in progress, as done or, when
+// err is set, as stopped. Only the dependencies that failed are shown as failed.
+func (p *Progress) Finish(err error) {
+	if p == nil {
+		return
+	}
+	settled := Done
+	if err != nil {
+		settled = Stopped
+	}
+
+	p.mu.Lock()
+	var pending, names []string
+	for _, key := range p.keys {
+		if state := p.states[key]; state != Done && state != Failed {
+			pending = append(pending, key)
+			names = append(names, p.names[key])
+		}
+	}
+	p.mu.Unlock()
+
+	for i, key := range pending {
+		p.Update(key, names[i], settled)
+	}
+}
+
+// Write prints a message above the dependencies, so that messages printed while
+// they are redrawn in place don't garble their lines. A nil Progress writes to
+// stdout.
+func (p *Progress) Write(b []byte) (int, error) {
+	if p == nil {
+		return os.Stdout.Write(b)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.live || p.drawn == 0 {
+		return p.out.Write(b)
+	}
+
+	// Clear the lines, print the message in their place and draw them again below it
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "\x1b[%dA\x1b[J", p.drawn)
+	buf.Write(b)
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	if _, err := io.WriteString(p.out, buf.String()); err != nil {
+		return 0, err
+	}
+	p.drawn = 0
+	p.redraw()
+	return len(b), nil
+}
+
+func (p *Progress) redraw() {
+	labels := make([]string, len(p.keys))
+	width := 0
+	for i, key := range p.keys {
+		labels[i] = p.label(key)
+		if len(labels[i]) > width {
+			width = len(labels[i])
+		}
+	}
+
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", p.drawn)
+	}
+	for i, key := range p.keys {
+		fmt.Fprintf(&b, "\x1b[2K  %-*s  %s\n", width, labels[i], p.states[key])
+	}
+	p.drawn = len(p.keys)
+	io.WriteString(p.out, b.String())
+}
@@ -0,0 +1,28 @@
+package progress
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSameNameDifferentKeys(t *testing.T) {
+	var out bytes.Buffer
+	p := &Progress{out: &out, names: map[string]string{}, states: map[string]State{}}
+
+	p.Update("github.com/a/addons", "addons", Cloning)
+	p.Update("github.com/b/addons", "addons", Cloning)
+	p.Update("github.com/b/addons", "addons", Failed)
+	p.Finish(errors.New("failed"))
+
+	want := "addons: cloning\n" +
+		"addons (github.com/b/addons): cloning\n" +
+		"addons (github.com/b/addons): failed\n" +
+		"addons (github.com/a/addons): stopped\n"
+	if out.String() != want {
+		t.Errorf("printed\n%s\nwant\n%s", out.String(), want)
+	}
+	if p.states["github.com/a/addons"] != Stopped || p.states["github.com/b/addons"] != Failed {
+		t.Errorf("states = %v", p.states)
+	}
+}
@@ -0,0 +1,31 @@
+package project
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Archive is a zip or tarball dependency downloaded over HTTP(S).
+type Archive struct {
+	URL         string `json:"url"`
+	SHA256      string `json:"sha256"`                // Checksum of the archive, which must match before anything is extracted
+	StripPrefix string `json:"stripPrefix,omitempty"` // Directory inside the archive that is used as its root, such as "addon-1.2"
+}
+
+// Validate checks that the archive can be downloaded and verified, and that its
+// prefix stays inside it.
+func (a Archive) Validate() error {
+	if !strings.HasPrefix(a.URL, "http://") && !strings.HasPrefix(a.URL, "https://") {
+		return fmt.Errorf("archive URL '%s' must be http or https", a.URL)
+	}
+	if sum, err := hex.DecodeString(a.SHA256); err != nil || len(sum) != 32 {
+		return fmt.Errorf("archive SHA-256 '%s' must be 64 hexadecimal digits", a.SHA256)
+	}
+	if a.StripPrefix != "" {
+		if err := validateRelative(a.StripPrefix); err != nil {
+			return fmt.Errorf("invalid strip prefix: %v", err)
+		}
+	}
+	return nil
+}
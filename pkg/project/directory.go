@@ -0,0 +1,99 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Directory selects a directory of a dependency to link into the project. Without
+// a target it is linked under the dependency's folder in the modules directory,
+// keeping its path; with one it is linked at that path, relative to the project.
+//
+// In the manifest a plain entry is written as a string, and a mapped one as an
+// object with "from" and "to" keys.
+type Directory struct {
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+}
+
+// ParseDirectory reads a directory given on the command line, either "path" or
+// "from:to".
+func ParseDirectory(s string) (Directory, error) {
+	dir := Directory{From: s}
+	if from, to, found := strings.Cut(s, ":"); found {
+		dir = Directory{From: from, To: to}
+	}
+	return dir, dir.Validate()
+}
+
+// Validate checks that both ends of the directory stay inside their roots.
+func (d Directory) Validate() error {
+	if err := validateRelative(d.From); err != nil {
+		return fmt.Errorf("invalid directory '%s': %v", d, err)
+	}
+	if d.To != "" {
+		if err := validateRelative(d.To); err != nil {
+			return fmt.Errorf("invalid directory '%s': %v", d, err)
+		}
+	}
+	return nil
+}
+
+func validateRelative(path string) error {
+	if path == "" {
+		return fmt.Errorf("path is empty")
+	}
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "/") {
+		return fmt.Errorf("'%s' must be a relative path", path)
+	}
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("'%s' must stay inside its root", path)
+	}
+	return nil
+}
+
+func (d Directory) String() string {
+	if d.To == "" {
+		return d.From
+	}
+	return d.From + " -> " + d.To
+}
+
+func (d Directory) MarshalJSON() ([]byte, error) {
+	if d.To == "" {
+		return json.Marshal(d.From)
+	}
+	type mapping Directory
+	return json.Marshal(mapping(d))
+}
+
+func (d *Directory) UnmarshalJSON(data []byte) error {
+	var from string
+	if err := json.Unmarshal(data, &from); err == nil {
+		*d = Directory{From: from}
+		return nil
+	}
+	type mapping Directory
+	var m mapping
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("directory must be a path or an object with 'from' and 'to': %v", err)
+	}
+	*d = Directory(m)
+	return nil
+}
+
+// ParseDirectories parses every directory given on the command line.
+func ParseDirectories(dirs []string) ([]Directory, error) {
+	var parsed []Directory
+	for _, s := range dirs {
+		dir, err := ParseDirectory(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, dir)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,33 @@
+package project
+
+// GroupFilter selects the dependencies of a project by group. Dependencies
+// without a group are always selected.
+type GroupFilter struct {
+	With    []string // When set, only these groups are selected besides ungrouped dependencies
+	Without []string // Groups that are never selected
+}
+
+func (f GroupFilter) Includes(dep Dependency) bool {
+	if dep.Group == "" {
+		return true
+	}
+	for _, group := range f.Without {
+		if group == dep.Group {
+			return false
+		}
+	}
+	if len(f.With) == 0 {
+		return true
+	}
+	for _, group := range f.With {
+		if group == dep.Group {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty reports whether the filter selects every dependency.
+func (f GroupFilter) Empty() bool {
+	return len(f.With) == 0 && len(f.Without) == 0
+}
@@ -0,0 +1,130 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/semver"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LockJson is written next to the .gogetty manifest and records exactly
+// what every dependency resolved to on the last fetch.
+const LockJson = ".gogetty.lock"
+
+type Lock struct {
+	Modules []LockedModule `json:"modules"`
+	Links   []string       `json:"links,omitempty"` // Mapped directories linked outside the modules directory, relative to the project
+}
+
+type LockedModule struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Branch   string `json:"branch,omitempty"`  // Branch requested by the manifest, if any
+	Version  string `json:"version,omitempty"` // Tag chosen for the manifest's version constraint, if any
+	Commit   string `json:"commit"`            // Resolved commit SHA
+	Path     string `json:"path"`              // Cache path, relative to the module cache
+	Checksum string `json:"checksum"`          // Git tree hash of the resolved commit
+	Direct   bool   `json:"direct"`            // Declared by the root manifest rather than a dependency
+}
+
+// Find returns the first locked module for the given URL, or nil if there is none.
+func (l *Lock) Find(url string) *LockedModule {
+	for i, mod := range l.Modules {
+		if gitop.SameURL(mod.URL, url) {
+			return &l.Modules[i]
+		}
+	}
+	return nil
+}
+
+func GetLockFile(projectDir string) (Lock, error) {
+	var lock Lock
+	path := filepath.Join(projectDir, LockJson)
+	file, err := os.Open(path)
+	if err != nil {
+		return lock, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&lock); err != nil {
+		return lock, fmt.Errorf("error reading %s: %v", LockJson, err)
+	}
+
+	return lock, nil
+}
+
+func WriteLockFile(projectDir string, lock Lock) error {
+	return writeJSON(filepath.Join(projectDir, LockJson), lock)
+}
+
+// VerifyLock checks that the lock still satisfies every dependency declared in
+// the manifest, and that it doesn't hold direct dependencies the manifest dropped.
+func VerifyLock(project Project, lock Lock) error {
+	for _, dep := range project.Dependencies {
+		if err := VerifyDependency(dep, lock); err != nil {
+			return err
+		}
+	}
+
+	if dropped := Undeclared(project, lock); len(dropped) > 0 {
+		return fmt.Errorf("%s is locked but no longer in %s", dropped[0].URL, ProjectJson)
+	}
+
+	return nil
+}
+
+// VerifyDependency checks that the lock holds a direct dependency at a revision
+// the manifest still allows. Local dependencies and archives are never locked.
+func VerifyDependency(dep Dependency, lock Lock) error {
+	if !dep.IsRepository() {
+		return nil
+	}
+	locked := lock.Find(dep.Repository.URL)
+	if locked == nil || !locked.Direct {
+		return fmt.Errorf("%s is not in %s", dep.Repository.URL, LockJson)
+	}
+	if dep.Repository.Branch != "" && dep.Repository.Branch != locked.Branch {
+		return fmt.Errorf("%s is locked to branch '%s' but the manifest asks for '%s'", dep.Repository.URL, locked.Branch, dep.Repository.Branch)
+	}
+	if dep.Repository.Commit != "" && !strings.HasPrefix(locked.Commit, dep.Repository.Commit) {
+		return fmt.Errorf("%s is locked to commit %s but the manifest asks for %s", dep.Repository.URL, locked.Commit, dep.Repository.Commit)
+	}
+	if dep.Version != "" {
+		return checkLockedVersion(dep, *locked)
+	}
+	return nil
+}
+
+// Undeclared returns the direct dependencies of the lock the manifest dropped.
+func Undeclared(project Project, lock Lock) []LockedModule {
+	declared := map[string]bool{}
+	for _, dep := range project.Dependencies {
+		if dep.IsRepository() {
+			declared[gitop.NormalizeURL(dep.Repository.URL)] = true
+		}
+	}
+
+	var dropped []LockedModule
+	for _, mod := range lock.Modules {
+		if mod.Direct && !declared[gitop.NormalizeURL(mod.URL)] {
+			dropped = append(dropped, mod)
+		}
+	}
+	return dropped
+}
+
+func checkLockedVersion(dep Dependency, locked LockedModule) error {
+	constraint, err := semver.ParseConstraint(dep.Version)
+	if err != nil {
+		return err
+	}
+	version, err := semver.Parse(locked.Version)
+	if err != nil || !constraint.Check(version) {
+		return fmt.Errorf("%s is locked to version '%s' but the manifest asks for %s", dep.Repository.URL, locked.Version, dep.Version)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// OverridesJson is written next to the .gogetty manifest by 'gogetty develop'.
+// It belongs to the user who wrote it and is never committed.
+const OverridesJson = ".gogetty.user"
+
+type Overrides struct {
+	Develop map[string]string `json:"develop,omitempty"` // Working copies linked in place of dependencies, by name, absolute or relative to the project
+}
+
+// Dir returns the working copy overriding the named dependency, resolving a
+// relative path against the project directory, and whether there is one.
+func (o Overrides) Dir(projectDir, name string) (string, bool) {
+	path, ok := o.Develop[name]
+	if !ok {
+		return "", false
+	}
+	return resolveDir(projectDir, path), true
+}
+
+// GetOverrides reads the overrides of the project. A project without an
+// overrides file has none.
+func GetOverrides(projectDir string) (Overrides, error) {
+	var overrides Overrides
+	data, err := os.ReadFile(filepath.Join(projectDir, OverridesJson))
+	if os.IsNotExist(err) {
+		return overrides, nil
+	}
+	if err != nil {
+		return overrides, err
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return overrides, fmt.Errorf("error reading %s: %v", OverridesJson, err)
+	}
+	return overrides, nil
+}
+
+// WriteOverrides writes the overrides of the project, removing the file once
+// there are none left.
+func WriteOverrides(projectDir string, overrides Overrides) error {
+	path := filepath.Join(projectDir, OverridesJson)
+	if len(overrides.Develop) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeJSON(path, overrides)
+}
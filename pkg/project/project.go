@@ -6,20 +6,102 @@ import (
 	"gogetty/pkg/gitop"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type Project struct {
-	Dependencies []Dependency `json:"modules"`
-	ModulesDir   string       `json:"modulesDirectory"`
+	SchemaVersion int          `json:"schemaVersion"`
+	Dependencies  []Dependency `json:"modules"`
+	ModulesDir    string       `json:"modulesDirectory"`
 }
 
 type Dependency struct {
 	Repository  gitop.GitRepo `json:"repository"`
-	Directories []string      `json:"directories"`
+	Path        string        `json:"path,omitempty"`       // Local directory linked in place of a repository, absolute or relative to the project
+	Archive     *Archive      `json:"archive,omitempty"`    // Zip or tarball downloaded in place of a repository
+	Alias       string        `json:"alias,omitempty"`      // Overrides the name the dependency is linked and referred to by
+	Version     string        `json:"version,omitempty"`    // Semantic version constraint resolved against the remote's tags
+	Group       string        `json:"group,omitempty"`      // Group the dependency belongs to, such as "dev", for selective fetches
+	Submodules  bool          `json:"submodules,omitempty"` // Initializes the repository's submodules at the revisions it pins
+	LFS         bool          `json:"lfs,omitempty"`        // Downloads the repository's Git LFS objects in place of their pointer files
+	Mirrors     []string      `json:"mirrors,omitempty"`    // URLs tried in order when the repository's own can't be fetched
+	Directories []Directory   `json:"directories"`
 }
 
 const ProjectJson = ".gogetty"
 
+// Name returns the name the dependency is linked and referred to by: its alias if
+// it has one, otherwise the name derived from its URL.
+func (d Dependency) Name() string {
+	if d.Alias != "" {
+		return d.Alias
+	}
+	if d.Repository.Name != "" {
+		return d.Repository.Name
+	}
+	return gitop.GetNameFromURL(d.Repository.URL)
+}
+
+// IsLocal reports whether the dependency is a local directory rather than a
+// repository. Local dependencies are linked as they are, and never cached or locked.
+func (d Dependency) IsLocal() bool {
+	return d.Path != ""
+}
+
+// IsArchive reports whether the dependency is an archive downloaded over HTTP
+// rather than a repository. Archives are pinned by their checksum, so they are
+// never locked either.
+func (d Dependency) IsArchive() bool {
+	return d.Archive != nil
+}
+
+// IsRepository reports whether the dependency is a git repository, which is
+// resolved into the dependency graph and recorded in the lockfile.
+func (d Dependency) IsRepository() bool {
+	return !d.IsLocal() && !d.IsArchive()
+}
+
+// Source returns the repository URL of the dependency, the path of a local one or
+// the URL of an archive.
+func (d Dependency) Source() string {
+	if d.IsLocal() {
+		return d.Path
+	}
+	if d.IsArchive() {
+		return d.Archive.URL
+	}
+	return d.Repository.URL
+}
+
+// LocalDir returns the directory of a local dependency, resolving a relative path
+// against the project directory.
+func (d Dependency) LocalDir(projectDir string) string {
+	return resolveDir(projectDir, d.Path)
+}
+
+// resolveDir returns a directory given as an absolute path or one relative to the
+// project directory.
+func resolveDir(projectDir, dir string) string {
+	dir = filepath.FromSlash(dir)
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(projectDir, dir)
+}
+
+// same reports whether two entries declare the same dependency: the same
+// repository, the same local directory, or archives of the same name, so that
+// adding another release of an archive replaces the previous one.
+func (d Dependency) same(other Dependency) bool {
+	if d.IsLocal() || other.IsLocal() {
+		return d.Path == other.Path
+	}
+	if d.IsArchive() || other.IsArchive() {
+		return d.IsArchive() && other.IsArchive() && d.Name() == other.Name()
+	}
+	return gitop.SameURL(d.Repository.URL, other.Repository.URL)
+}
+
 func Init() error {
 	if _, err := os.Stat(ProjectJson); err == nil {
 		return fmt.Errorf(".gogetty already exists")
@@ -29,6 +111,7 @@ func Init() error {
 		Dependencies: []Dependency{},
 		ModulesDir:   "modules",
 	}
+	config.SchemaVersion = requiredVersion(config)
 	file, err := os.Create(ProjectJson)
 	if err != nil {
 		return fmt.Errorf("error creating .gogetty: %v", err)
@@ -56,7 +139,7 @@ func UpdateDependency(old_dependency Dependency, new_dependency Dependency) erro
 
 	updated := false
 	for i, dep := range project.Dependencies {
-		if dep.Repository.URL == old_dependency.Repository.URL {
+		if dep.same(old_dependency) {
 			// Update the existing dependency with the new information
 			project.Dependencies[i] = new_dependency
 			updated = true
@@ -65,26 +148,40 @@ func UpdateDependency(old_dependency Dependency, new_dependency Dependency) erro
 	}
 
 	if !updated {
-		return fmt.Errorf("Dependency not found for URL: %s", old_dependency.Repository.URL)
+		return fmt.Errorf("Dependency not found for URL: %s", old_dependency.Source())
 	}
 
 	return writeProject("", project)
 }
 
-func AddDependency(repo gitop.GitRepo, directories []string) error {
+// ValidateName checks that a dependency name can be used as a link name.
+func ValidateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid dependency name '%s'", name)
+	}
+	return nil
+}
+
+func AddDependency(newDependency Dependency) error {
 	project, err := readProject("")
 	if err != nil {
 		return err
 	}
 
-	newDependency := Dependency{
-		Repository:  repo,
-		Directories: directories,
+	if err := ValidateName(newDependency.Name()); err != nil {
+		return err
+	}
+
+	// Names are used for links and commands, so they must be unique among other repositories
+	for _, dep := range project.Dependencies {
+		if dep.Name() == newDependency.Name() && !dep.same(newDependency) {
+			return fmt.Errorf("a dependency named '%s' already exists (%s), use --alias to give this one another name", dep.Name(), dep.Source())
+		}
 	}
 
 	updated := false
 	for i, dep := range project.Dependencies {
-		if dep.Repository.URL == newDependency.Repository.URL {
+		if dep.same(newDependency) {
 			project.Dependencies[i] = newDependency
 			updated = true
 			break
@@ -105,7 +202,7 @@ func RemoveDependency(repoName string) error {
 	}
 
 	for i, d := range project.Dependencies {
-		if d.Repository.Name == repoName {
+		if d.Name() == repoName {
 			project.Dependencies = append(project.Dependencies[:i], project.Dependencies[i+1:]...)
 			return writeProject("", project)
 		}
@@ -121,7 +218,7 @@ func Find(name string) (Dependency, error) {
 	}
 
 	for _, dep := range project.Dependencies {
-		if dep.Repository.Name == name {
+		if dep.Name() == name {
 			return dep, nil
 		}
 	}
@@ -130,31 +227,38 @@ func Find(name string) (Dependency, error) {
 }
 
 func readProject(projectDir string) (Project, error) {
-	var project Project
 	path := filepath.Join(projectDir, ProjectJson)
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return project, err
+		return Project{}, err
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&project); err != nil {
-		return project, err
-	}
-
-	return project, nil
+	project, _, err := decodeProject(data)
+	return project, err
 }
 
 func writeProject(projectDir string, project Project) error {
-	path := filepath.Join(projectDir, ProjectJson)
-	file, err := os.Create(path)
+	project.SchemaVersion = requiredVersion(project)
+	return writeJSON(filepath.Join(projectDir, ProjectJson), project)
+}
+
+// writeJSON writes v through a temporary file renamed over path, so that another
+// gogetty reading it at the same time never sees it half written.
+func writeJSON(path string, v any) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer os.Remove(file.Name())
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(project)
+	if err := encoder.Encode(v); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
 }
@@ -0,0 +1,145 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"gogetty/pkg/gitop"
+	"os"
+	"path/filepath"
+)
+
+// SchemaVersion is the newest manifest schema this version of gogetty reads.
+// Manifests written before schema versions existed are version 0. Versions after
+// the first only add fields that older versions would misread, so nothing needs
+// migrating and a manifest is written with the lowest version covering the
+// fields it uses, see requiredVersion:
+//
+//	1: the cache path is no longer stored in the manifest, dependencies may
+//	   have a version constraint
+//	2: directories may be mapped to a path in the project, dependencies may
+//	   have an alias
+//	3: dependencies may be local directories, and may have a group, submodules,
+//	   Git LFS objects or mirrors
+//	4: dependencies may be archives
+//
+// A field is listed under the first version that every gogetty accepting it
+// reads, since an older one would silently drop it.
+const SchemaVersion = 4
+
+// migrations[i] upgrades a decoded manifest from schema version i to i+1.
+var migrations = []func(manifest map[string]interface{}) error{
+	migrateV0,
+}
+
+// migrateV0 drops the machine specific cache path that fetch used to write into
+// every repository, and records the name each dependency was derived from.
+func migrateV0(manifest map[string]interface{}) error {
+	modules, _ := manifest["modules"].([]interface{})
+	for _, module := range modules {
+		dep, ok := module.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid module entry: %v", module)
+		}
+		repo, ok := dep["repository"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		delete(repo, "Path")
+		if name, _ := repo["Name"].(string); name == "" {
+			if url, _ := repo["URL"].(string); url != "" {
+				repo["Name"] = gitop.GetNameFromURL(url)
+			}
+		}
+	}
+	return nil
+}
+
+// requiredVersion returns the lowest schema version that can hold the project,
+// so that older versions of gogetty keep reading manifests that don't use any
+// of the newer fields.
+func requiredVersion(project Project) int {
+	version := len(migrations)
+	for _, dep := range project.Dependencies {
+		for _, dir := range dep.Directories {
+			if dir.To != "" {
+				version = max(version, 2)
+			}
+		}
+		if dep.Alias != "" {
+			version = max(version, 2)
+		}
+		if dep.IsLocal() || dep.Group != "" || dep.Submodules || dep.LFS || len(dep.Mirrors) > 0 {
+			version = max(version, 3)
+		}
+		if dep.IsArchive() {
+			version = max(version, 4)
+		}
+	}
+	return version
+}
+
+// decodeProject decodes a manifest of any supported schema version, migrating it
+// in memory. It also returns the schema version the data was written with.
+func decodeProject(data []byte) (Project, int, error) {
+	var project Project
+
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return project, 0, err
+	}
+
+	version := 0
+	if v, ok := manifest["schemaVersion"].(float64); ok {
+		version = int(v)
+	}
+	if version > SchemaVersion {
+		return project, version, fmt.Errorf("%s uses schema version %d, but this version of gogetty only supports up to %d; please upgrade gogetty", ProjectJson, version, SchemaVersion)
+	}
+
+	for v := version; v < len(migrations); v++ {
+		if err := migrations[v](manifest); err != nil {
+			return project, version, fmt.Errorf("error migrating %s from schema version %d: %v", ProjectJson, v, err)
+		}
+	}
+	manifest["schemaVersion"] = max(version, len(migrations))
+
+	migrated, err := json.Marshal(manifest)
+	if err != nil {
+		return project, version, err
+	}
+	if err := json.Unmarshal(migrated, &project); err != nil {
+		return project, version, err
+	}
+
+	return project, version, nil
+}
+
+// Migrate upgrades the manifest in projectDir in place when it was written with
+// a schema version that needs migrating, keeping a copy of the original next to
+// it. Manifests that only lack newer fields are left alone.
+func Migrate(projectDir string) error {
+	path := filepath.Join(projectDir, ProjectJson)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	project, version, err := decodeProject(data)
+	if err != nil {
+		return err
+	}
+	if version >= len(migrations) {
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backupPath, data, 0644); err != nil {
+		return fmt.Errorf("error backing up %s: %v", ProjectJson, err)
+	}
+	if err := writeProject(projectDir, project); err != nil {
+		return err
+	}
+
+	fmt.Printf("Upgraded %s from schema version %d to %d, the original was saved to %s\n", ProjectJson, version, requiredVersion(project), filepath.Base(backupPath))
+	return nil
+}
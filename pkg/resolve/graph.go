@@ -0,0 +1,127 @@
+package resolve
+
+import (
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/project"
+	"strings"
+)
+
+// Graph is the fully resolved set of modules a project depends on, directly or
+// through the manifests of its dependencies.
+type Graph struct {
+	Root  *Node   // The project itself
+	Nodes []*Node // Every module, in the order it was discovered
+}
+
+// Node is a single module, shared by every manifest that depends on its URL.
+type Node struct {
+	URL          string
+	Repo         gitop.GitRepo // Clone selected for the module
+	Tag          string        // Tag the clone was made from, if a version was requested
+	Cached       bool          // Whether the clone was already in the cache
+	Checksum     string        // Git tree hash of the selected commit
+	ModulesDir   string        // Where the module's own dependencies are linked
+	Chain        []string      // Names leading from the project to the first manifest that required the module
+	Edges        []Edge        // Dependencies declared by the module's manifest
+	Requirements []Requirement // Every declaration of the module across the graph
+
+	selected selection
+}
+
+// Name is the name the module was first required by.
+func (n *Node) Name() string {
+	return n.Chain[len(n.Chain)-1]
+}
+
+type Edge struct {
+	Dependency project.Dependency
+	Node       *Node
+}
+
+// Requirement is a dependency as declared by one manifest in the graph.
+type Requirement struct {
+	Dependency project.Dependency
+	Chain      []string // Names leading from the project to the declaring manifest
+}
+
+func (r Requirement) String() string {
+	return strings.Join(r.Chain, " -> ") + " requires " + Constraint(r.Dependency)
+}
+
+// Constraint summarizes the revision a dependency declaration asks for.
+func Constraint(dep project.Dependency) string {
+	var parts []string
+	if dep.Version != "" {
+		parts = append(parts, "version "+dep.Version)
+	}
+	if dep.Repository.Branch != "" {
+		parts = append(parts, "branch "+dep.Repository.Branch)
+	}
+	if dep.Repository.Commit != "" {
+		parts = append(parts, "commit "+dep.Repository.Commit)
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "any revision")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Direct reports whether the node is declared by the project's own manifest.
+func (g *Graph) Direct(node *Node) bool {
+	for _, edge := range g.Root.Edges {
+		if edge.Node == node {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the part of the graph reachable through the project's
+// dependencies that the filter includes.
+func (g *Graph) Select(groups project.GroupFilter) *Graph {
+	root := *g.Root
+	root.Edges = nil
+	for _, edge := range g.Root.Edges {
+		if groups.Includes(edge.Dependency) {
+			root.Edges = append(root.Edges, edge)
+		}
+	}
+
+	selected := &Graph{Root: &root}
+	reachable := map[*Node]bool{}
+	var visit func(node *Node)
+	visit = func(node *Node) {
+		for _, edge := range node.Edges {
+			if !reachable[edge.Node] {
+				reachable[edge.Node] = true
+				visit(edge.Node)
+			}
+		}
+	}
+	visit(&root)
+
+	for _, node := range g.Nodes {
+		if reachable[node] {
+			selected.Nodes = append(selected.Nodes, node)
+		}
+	}
+	return selected
+}
+
+// Lock returns the lockfile describing the graph.
+func (g *Graph) Lock(moduleDir string) project.Lock {
+	lock := project.Lock{Modules: []project.LockedModule{}}
+	for _, node := range g.Nodes {
+		lock.Modules = append(lock.Modules, project.LockedModule{
+			Name:     node.Repo.Name,
+			URL:      node.URL,
+			Branch:   node.selected.Branch,
+			Version:  node.Tag,
+			Commit:   node.Repo.Commit,
+			Path:     relativePath(moduleDir, node.Repo.Path),
+			Checksum: node.Checksum,
+			Direct:   g.Direct(node),
+		})
+	}
+	return lock
+}
@@ -0,0 +1,401 @@
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"gogetty/pkg/cache"
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/progress"
+	"gogetty/pkg/project"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxRounds bounds how many times the graph is rebuilt while selections settle.
+const maxRounds = 10
+
+// Resolver builds the dependency graph of a project. Resolution only reads and
+// fills the module cache; nothing is linked into a project until it succeeds.
+type Resolver struct {
+	Cache    []gitop.GitRepo     // Modules already in the cache
+	Frozen   *project.Lock       // When set, every module is taken from the lock instead of being resolved
+	Groups   project.GroupFilter // Selects which of the project's own dependencies are resolved
+	Locked   *project.Lock       // Previous lock, which keeps unpinned branches where they were and stands in for tags offline
+	Upgrades map[string]string   // Commits that modules move to instead of their locked ones, by normalized URL
+	Jobs     int                 // Modules cloned at once, at least one
+	Progress *progress.Progress  // Shows each module being cloned and checked out, may be nil
+
+	selected map[string]selection
+	tags     map[string][]gitop.Tag
+	cloned   map[string]bool // Paths cloned by this resolver rather than found in the cache
+	missing  []string        // Modules that weren't in the cache while offline
+
+	mu sync.Mutex // Guards the fields above while modules are visited concurrently
+}
+
+// Resolve walks the project's manifest and the manifests of all its dependencies.
+// When several manifests require the same URL, a single revision satisfying all
+// of them is selected, and the graph is rebuilt until the selections settle.
+func (r *Resolver) Resolve(ctx context.Context, projectDir string) (*Graph, error) {
+	r.selected = map[string]selection{}
+	r.missing = nil
+	if r.tags == nil {
+		r.tags = map[string][]gitop.Tag{}
+		r.cloned = map[string]bool{}
+	}
+
+	for round := 0; round < maxRounds; round++ {
+		graph, err := r.walk(ctx, projectDir)
+		if len(r.missing) > 0 {
+			return nil, fmt.Errorf("%w, and these modules are not in %s:\n  %s", gitop.ErrOffline, cache.ModuleDir(), strings.Join(r.missing, "\n  "))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.Frozen != nil {
+			return graph, r.populate(ctx, graph)
+		}
+
+		// Re-select every module now that all of its requirements are known
+		changed := false
+		selected := map[string]selection{}
+		var failures []string
+		for _, node := range graph.Nodes {
+			sel, err := r.choose(ctx, node.URL, node.Requirements)
+			if err != nil {
+				failures = append(failures, err.Error())
+				continue
+			}
+			if sel != node.selected {
+				changed = true
+			}
+			selected[gitop.NormalizeURL(node.URL)] = sel
+		}
+		if len(failures) > 0 {
+			return nil, fmt.Errorf("failed to resolve dependencies:\n%s", strings.Join(failures, "\n"))
+		}
+		if !changed {
+			return graph, r.populate(ctx, graph)
+		}
+		r.selected = selected
+	}
+
+	return nil, fmt.Errorf("dependency resolution did not settle after %d rounds", maxRounds)
+}
+
+// walk builds the graph breadth first using the current selections, selecting
+// modules that don't have one yet from the first requirement that reaches them.
+// The modules a level of the graph reaches for the first time are visited
+// concurrently, see Jobs.
+func (r *Resolver) walk(ctx context.Context, projectDir string) (*Graph, error) {
+	root := &Node{
+		Repo:  gitop.GitRepo{Path: projectDir, Name: filepath.Base(projectDir)},
+		Chain: []string{filepath.Base(projectDir)},
+	}
+	graph := &Graph{Root: root}
+	nodes := map[string]*Node{}
+
+	// edge is a requirement waiting for the node it reaches
+	type edge struct {
+		parent *Node
+		req    Requirement
+		key    string
+	}
+
+	var allErrors []error
+	level := []*Node{root}
+	for len(level) > 0 {
+		var edges []edge
+		var first []Requirement
+		reached := map[string]bool{}
+		for _, parent := range level {
+			proj, err := project.GetProjectFile(parent.Repo.Path)
+			if err != nil {
+				// Modules without a manifest have no dependencies of their own
+				if os.IsNotExist(err) && parent != root {
+					continue
+				}
+				return nil, err
+			}
+			parent.ModulesDir = proj.ModulesDir
+
+			names := map[string]string{}
+			for _, dep := range proj.Dependencies {
+				// Groups such as dev tools only matter to the project declaring them
+				if !included(dep, parent == root, r.Groups) {
+					continue
+				}
+				// Local directories and archives are linked by fetch outside of the
+				// graph. Those of a module aren't fetched: its local directories
+				// only exist on its author's machine
+				if !dep.IsRepository() {
+					continue
+				}
+				req := Requirement{Dependency: dep, Chain: parent.Chain}
+
+				// Each dependency is linked under its name, so two of them can't share one
+				if url, ok := names[dep.Name()]; ok && !gitop.SameURL(url, dep.Repository.URL) {
+					allErrors = append(allErrors, fmt.Errorf("%s declares both %s and %s as '%s', give one of them an alias", strings.Join(parent.Chain, " -> "), url, dep.Repository.URL, dep.Name()))
+					continue
+				}
+				names[dep.Name()] = dep.Repository.URL
+
+				key := gitop.NormalizeURL(dep.Repository.URL)
+				if _, ok := nodes[key]; !ok && !reached[key] {
+					reached[key] = true
+					first = append(first, req)
+				}
+				edges = append(edges, edge{parent: parent, req: req, key: key})
+			}
+		}
+
+		visited, errs := r.visitAll(ctx, first)
+		var next []*Node
+		for i, req := range first {
+			if errs[i] != nil {
+				allErrors = append(allErrors, errs[i])
+				continue
+			}
+			nodes[gitop.NormalizeURL(req.Dependency.Repository.URL)] = visited[i]
+			graph.Nodes = append(graph.Nodes, visited[i])
+			next = append(next, visited[i])
+		}
+
+		for _, e := range edges {
+			node, ok := nodes[e.key]
+			if !ok {
+				continue
+			}
+			node.Requirements = append(node.Requirements, e.req)
+			e.parent.Edges = append(e.parent.Edges, Edge{Dependency: e.req.Dependency, Node: node})
+		}
+		level = next
+	}
+
+	if len(allErrors) > 0 {
+		return nil, fmt.Errorf("multiple errors occurred: %v", allErrors)
+	}
+
+	return graph, nil
+}
+
+// visitAll visits the modules of the requirements, at most Jobs at a time, and
+// returns their nodes and errors in the same order.
+func (r *Resolver) visitAll(ctx context.Context, reqs []Requirement) ([]*Node, []error) {
+	nodes := make([]*Node, len(reqs))
+	errs := make([]error, len(reqs))
+	r.parallel(len(reqs), func(i int) {
+		nodes[i], errs[i] = r.visit(ctx, reqs[i])
+		if errs[i] != nil {
+			r.Progress.Update(gitop.NormalizeURL(reqs[i].Dependency.Repository.URL), reqs[i].Dependency.Name(), progress.Failed)
+		}
+	})
+	return nodes, errs
+}
+
+// parallel calls fn for every index below n, running at most Jobs calls at once.
+func (r *Resolver) parallel(n int, fn func(i int)) {
+	jobs := r.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	slots := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// visit creates the node for a module the first time a requirement reaches it,
+// making sure its selected revision is in the cache.
+func (r *Resolver) visit(ctx context.Context, req Requirement) (*Node, error) {
+	url := req.Dependency.Repository.URL
+
+	var sel selection
+	var locked *project.LockedModule
+	if r.Frozen != nil {
+		locked = r.Frozen.Find(url)
+		if locked == nil {
+			return nil, fmt.Errorf("%s is not in %s", url, project.LockJson)
+		}
+		sel = selection{Branch: locked.Branch, Commit: locked.Commit, Tag: locked.Version}
+	} else if s, ok := r.selected[gitop.NormalizeURL(url)]; ok {
+		sel = s
+	} else {
+		s, err := r.choose(ctx, url, []Requirement{req})
+		if err != nil {
+			return nil, err
+		}
+		sel = s
+	}
+
+	repo, cached, err := r.ensure(ctx, req, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := gitop.TreeHash(repo.Path)
+	if err != nil {
+		return nil, err
+	}
+	if locked != nil && locked.Checksum != checksum {
+		return nil, fmt.Errorf("checksum mismatch for %s: locked %s, found %s", url, locked.Checksum, checksum)
+	}
+
+	return &Node{
+		URL:      url,
+		Repo:     repo,
+		Tag:      sel.Tag,
+		Cached:   cached,
+		Checksum: checksum,
+		Chain:    append(append([]string{}, req.Chain...), req.Dependency.Name()),
+		selected: sel,
+	}, nil
+}
+
+// populate checks out the directories every module's requirements need, and
+// fetches the submodules and Git LFS objects they ask for. Clones are shared, so
+// this also happens when the clone was found in the cache.
+func (r *Resolver) populate(ctx context.Context, graph *Graph) error {
+	errs := make([]error, len(graph.Nodes))
+	r.parallel(len(graph.Nodes), func(i int) {
+		node := graph.Nodes[i]
+		r.Progress.Update(gitop.NormalizeURL(node.URL), node.Name(), progress.CheckingOut)
+
+		opts := gitop.PopulateOptions{Directories: neededDirectories(node.Requirements)}
+		for _, req := range node.Requirements {
+			opts.Submodules = opts.Submodules || req.Dependency.Submodules
+			opts.LFS = opts.LFS || req.Dependency.LFS
+		}
+		if errs[i] = gitop.Populate(ctx, node.Repo.Path, opts); errs[i] != nil {
+			r.Progress.Update(gitop.NormalizeURL(node.URL), node.Name(), progress.Failed)
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// neededDirectories returns the directories linked from a module, or nil when any
+// requirement links the whole repository. New clones only check those out.
+func neededDirectories(reqs []Requirement) []string {
+	var dirs []string
+	for _, req := range reqs {
+		if len(req.Dependency.Directories) == 0 {
+			return nil
+		}
+		for _, dir := range req.Dependency.Directories {
+			dirs = append(dirs, dir.From)
+		}
+	}
+	return dirs
+}
+
+// mirrors returns the mirrors every requirement lists, in order and without repeats.
+func mirrors(reqs []Requirement) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, req := range reqs {
+		for _, url := range req.Dependency.Mirrors {
+			if !seen[gitop.NormalizeURL(url)] {
+				seen[gitop.NormalizeURL(url)] = true
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls
+}
+
+// ensure returns the cached clone matching the selection, cloning it if needed.
+func (r *Resolver) ensure(ctx context.Context, req Requirement, sel selection) (gitop.GitRepo, bool, error) {
+	url := req.Dependency.Repository.URL
+	template := gitop.GitRepo{URL: url, Branch: sel.Branch, Commit: sel.Commit}
+	ref, commit := sel.Branch, sel.Commit
+	if sel.Tag != "" {
+		// Tag clones have a detached HEAD, so they are matched by commit alone. The
+		// commit is fetched rather than the tag, which upstream may have moved since
+		template.Branch = ""
+		ref = ""
+		if commit == "" {
+			ref = sel.Tag
+		}
+	}
+
+	if template.Commit == "" && !gitop.Offline() {
+		// Any clone of the branch would match otherwise, so look up its tip
+		remote, err := gitop.QueryRemote(ctx, url, mirrors([]Requirement{req}))
+		if err != nil {
+			return gitop.GitRepo{}, false, err
+		}
+		tip, ok := remote.Tip(sel.Branch)
+		if !ok {
+			return gitop.GitRepo{}, false, fmt.Errorf("%s has no branch %s", url, sel.Branch)
+		}
+		template.Commit = tip
+	}
+
+	r.mu.Lock()
+	if repo := gitop.Find(template, r.Cache); repo != nil {
+		defer r.mu.Unlock()
+		return *repo, !r.cloned[repo.Path], nil
+	}
+	if gitop.Offline() {
+		defer r.mu.Unlock()
+		if template.Commit == "" {
+			// The tip can't be looked up, and several cached clones of the branch may differ
+			r.missing = append(r.missing, url+" at "+sel.String()+", which "+project.LockJson+" doesn't record")
+			return gitop.GitRepo{}, false, fmt.Errorf("%w, the tip of %s can't be looked up and %s doesn't record it", gitop.ErrOffline, url, project.LockJson)
+		}
+		r.missing = append(r.missing, url+" at "+sel.String())
+		return gitop.GitRepo{}, false, fmt.Errorf("%s at %s is not in the cache", url, sel)
+	}
+	r.mu.Unlock()
+
+	r.Progress.Update(gitop.NormalizeURL(url), req.Dependency.Name(), progress.Cloning)
+	sparse := neededDirectories([]Requirement{req})
+	repo, err := gitop.Fetch(ctx, cache.ModuleDir(), url, mirrors([]Requirement{req}), ref, commit, sparse)
+	if err != nil {
+		return gitop.GitRepo{}, false, fmt.Errorf("error fetching %s: %v", url, err)
+	}
+	if sel.Tag != "" {
+		repo.Branch = ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Cache = append(r.Cache, *repo)
+	r.cloned[repo.Path] = true
+	return *repo, false, nil
+}
+
+// included reports whether a dependency takes part in the graph. The project's own
+// dependencies are selected by the group filter, while grouped dependencies of a
+// module are never needed by the projects using it.
+func included(dep project.Dependency, direct bool, groups project.GroupFilter) bool {
+	if direct {
+		return groups.Includes(dep)
+	}
+	return dep.Group == ""
+}
+
+func relativePath(base, path string) string {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
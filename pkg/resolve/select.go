@@ -0,0 +1,190 @@
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"gogetty/pkg/gitop"
+	"gogetty/pkg/project"
+	"gogetty/pkg/semver"
+	"strings"
+)
+
+// selection is the single revision chosen for a URL.
+type selection struct {
+	Branch string
+	Commit string
+	Tag    string
+}
+
+func (s selection) String() string {
+	switch {
+	case s.Tag != "":
+		return "tag " + s.Tag
+	case s.Commit != "":
+		return "commit " + s.Commit
+	case s.Branch != "":
+		return "the tip of branch " + s.Branch
+	}
+	return "the tip of the default branch"
+}
+
+// choose picks a revision satisfying every requirement on a URL, or returns an
+// error listing each chain of manifests that asked for something different.
+//
+// Commit pins must all name the same commit, and branches must all agree. Version
+// constraints are intersected, and the highest tag allowed by all of them wins;
+// when a commit is also pinned, that tag must point at the pinned commit.
+func (r *Resolver) choose(ctx context.Context, url string, reqs []Requirement) (selection, error) {
+	var sel selection
+	var constraints []semver.Constraint
+
+	for _, req := range reqs {
+		dep := req.Dependency
+		if commit := dep.Repository.Commit; commit != "" {
+			if sel.Commit != "" && !gitop.SameCommit(sel.Commit, commit) {
+				return sel, conflict(url, reqs)
+			}
+			if len(commit) > len(sel.Commit) {
+				sel.Commit = commit
+			}
+		}
+		if branch := dep.Repository.Branch; branch != "" {
+			if sel.Branch != "" && sel.Branch != branch {
+				return sel, conflict(url, reqs)
+			}
+			sel.Branch = branch
+		}
+		if dep.Version != "" {
+			c, err := semver.ParseConstraint(dep.Version)
+			if err != nil {
+				return sel, fmt.Errorf("%s: %v", req, err)
+			}
+			constraints = append(constraints, c)
+		}
+	}
+
+	if len(constraints) == 0 {
+		// An unpinned branch stays at the commit it was locked at, until an upgrade
+		// moves it to a newer one
+		if sel.Commit == "" {
+			sel.Commit = r.lockedCommit(url, sel.Branch)
+		}
+		return sel, nil
+	}
+
+	// Like a branch, a constraint stays at its locked tag until an upgrade moves it
+	if tag, ok := r.lockedTag(url, sel, constraints); ok {
+		return selection{Branch: sel.Branch, Commit: tag.Commit, Tag: tag.Name}, nil
+	}
+
+	tags, err := r.listTags(ctx, url, mirrors(reqs))
+	if err != nil {
+		return sel, err
+	}
+
+	var candidates []gitop.Tag
+	for _, tag := range tags {
+		if sel.Commit == "" || gitop.SameCommit(tag.Commit, sel.Commit) {
+			candidates = append(candidates, tag)
+		}
+	}
+
+	var best gitop.Tag
+	var bestVersion semver.Version
+	for _, tag := range candidates {
+		v, err := semver.Parse(tag.Name)
+		if err != nil || !satisfiesAll(constraints, v) {
+			continue
+		}
+		if best.Name == "" || semver.Compare(v, bestVersion) > 0 {
+			best, bestVersion = tag, v
+		}
+	}
+	if best.Name == "" {
+		return sel, conflict(url, reqs)
+	}
+
+	// The branch isn't checked out, since tags are, but it is still recorded in the lock
+	return selection{Branch: sel.Branch, Commit: best.Commit, Tag: best.Name}, nil
+}
+
+// lockedCommit returns the commit an unpinned branch of url is upgraded to, or
+// else the one the lock recorded for it, if it was locked at the same branch.
+func (r *Resolver) lockedCommit(url, branch string) string {
+	if commit, ok := r.Upgrades[gitop.NormalizeURL(url)]; ok {
+		return commit
+	}
+	if r.Locked == nil {
+		return ""
+	}
+	if mod := r.Locked.Find(url); mod != nil && mod.Version == "" && mod.Branch == branch {
+		return mod.Commit
+	}
+	return ""
+}
+
+// lockedTag returns the tag the lock recorded for url, as long as it satisfies
+// every constraint and the pinned commit, if any, and url isn't being upgraded.
+func (r *Resolver) lockedTag(url string, sel selection, constraints []semver.Constraint) (gitop.Tag, bool) {
+	if _, ok := r.Upgrades[gitop.NormalizeURL(url)]; ok || r.Locked == nil {
+		return gitop.Tag{}, false
+	}
+	mod := r.Locked.Find(url)
+	if mod == nil || mod.Version == "" || (sel.Commit != "" && !gitop.SameCommit(mod.Commit, sel.Commit)) {
+		return gitop.Tag{}, false
+	}
+	v, err := semver.Parse(mod.Version)
+	if err != nil || !satisfiesAll(constraints, v) {
+		return gitop.Tag{}, false
+	}
+	return gitop.Tag{Name: mod.Version, Commit: mod.Commit}, true
+}
+
+func (r *Resolver) listTags(ctx context.Context, url string, mirrors []string) ([]gitop.Tag, error) {
+	key := gitop.NormalizeURL(url)
+	r.mu.Lock()
+	tags, ok := r.tags[key]
+	r.mu.Unlock()
+	if ok {
+		return tags, nil
+	}
+
+	// The remote can't be listed offline, but the lock knows the tag it chose last time
+	if gitop.Offline() {
+		if r.Locked != nil {
+			if mod := r.Locked.Find(url); mod != nil && mod.Version != "" {
+				return []gitop.Tag{{Name: mod.Version, Commit: mod.Commit}}, nil
+			}
+		}
+		r.mu.Lock()
+		r.missing = append(r.missing, url+" at a version tag, which "+project.LockJson+" doesn't record")
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w, the tags of %s can't be listed and %s doesn't record one", gitop.ErrOffline, url, project.LockJson)
+	}
+	tags, err := gitop.ListTags(ctx, url, mirrors)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.tags[key] = tags
+	r.mu.Unlock()
+	return tags, nil
+}
+
+func satisfiesAll(constraints []semver.Constraint, v semver.Version) bool {
+	for _, c := range constraints {
+		if !c.Check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func conflict(url string, reqs []Requirement) error {
+	lines := []string{fmt.Sprintf("  %s is required with incompatible revisions:", url)}
+	for _, req := range reqs {
+		lines = append(lines, "    "+req.String())
+	}
+	return fmt.Errorf("%s", strings.Join(lines, "\n"))
+}
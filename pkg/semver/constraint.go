@@ -0,0 +1,181 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of alternative version ranges, e.g. "^1.2.0", "~4.1" or
+// ">=2.0 <3.0 || ^4". A version satisfies it if it satisfies any alternative.
+type Constraint struct {
+	alternatives [][]comparator
+	original     string
+}
+
+type comparator struct {
+	op string // One of "=", "!=", ">", ">=", "<", "<="
+	v  Version
+}
+
+var operators = []string{">=", "<=", "!=", ">", "<", "=", "^", "~"}
+
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{original: s}
+	if strings.TrimSpace(s) == "" {
+		return c, fmt.Errorf("empty version constraint")
+	}
+
+	for _, alt := range strings.Split(s, "||") {
+		// Allow "> = 1.0" style spacing by attaching each operator to its version
+		alt = strings.ReplaceAll(alt, ",", " ")
+		for _, op := range operators {
+			alt = strings.ReplaceAll(alt, op+" ", op)
+		}
+
+		var comparators []comparator
+		for _, term := range strings.Fields(alt) {
+			terms, err := parseTerm(term)
+			if err != nil {
+				return c, fmt.Errorf("invalid version constraint '%s': %v", s, err)
+			}
+			comparators = append(comparators, terms...)
+		}
+		if len(comparators) == 0 {
+			return c, fmt.Errorf("invalid version constraint '%s'", s)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+	}
+
+	return c, nil
+}
+
+// parseTerm expands a single term into plain comparators, turning caret, tilde and
+// partial versions into the range they stand for.
+func parseTerm(term string) ([]comparator, error) {
+	op := ""
+	for _, candidate := range operators {
+		if strings.HasPrefix(term, candidate) {
+			op = candidate
+			break
+		}
+	}
+
+	rest := strings.TrimPrefix(term, op)
+	if rest == "*" || rest == "x" || rest == "X" {
+		return []comparator{{op: ">=", v: Version{}}}, nil
+	}
+
+	v, given, err := parsePartial(rest)
+	if err != nil {
+		return nil, err
+	}
+	if given == 0 {
+		return []comparator{{op: ">=", v: Version{}}}, nil
+	}
+
+	switch op {
+	case "^":
+		// Allow changes that don't modify the left-most non-zero number
+		upper := Version{Major: v.Major + 1}
+		if v.Major == 0 && given > 1 {
+			upper = Version{Minor: v.Minor + 1}
+			if v.Minor == 0 && given > 2 {
+				upper = Version{Patch: v.Patch + 1}
+			}
+		}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	case "~":
+		// Allow patch level changes, or minor level changes when only the major is given
+		upper := Version{Major: v.Major, Minor: v.Minor + 1}
+		if given == 1 {
+			upper = Version{Major: v.Major + 1}
+		}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	case "", "=":
+		if given == 3 {
+			return []comparator{{"=", v}}, nil
+		}
+		return []comparator{{">=", v}, {"<", nextPartial(v, given)}}, nil
+	case ">":
+		if given == 3 {
+			return []comparator{{">", v}}, nil
+		}
+		return []comparator{{">=", nextPartial(v, given)}}, nil
+	case "<=":
+		if given == 3 {
+			return []comparator{{"<=", v}}, nil
+		}
+		return []comparator{{"<", nextPartial(v, given)}}, nil
+	}
+
+	return []comparator{{op, v}}, nil
+}
+
+// nextPartial returns the first version past every version matched by a partial one,
+// e.g. 1.3.0 for "1.2" and 2.0.0 for "1".
+func nextPartial(v Version, given int) Version {
+	if given == 1 {
+		return Version{Major: v.Major + 1}
+	}
+	return Version{Major: v.Major, Minor: v.Minor + 1}
+}
+
+// Check reports whether v satisfies the constraint. Pre-releases only match an
+// alternative that names a pre-release of the same major, minor and patch.
+func (c Constraint) Check(v Version) bool {
+	for _, comparators := range c.alternatives {
+		if matchesAll(comparators, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAll(comparators []comparator, v Version) bool {
+	preAllowed := v.Pre == ""
+	for _, cmp := range comparators {
+		if !cmp.matches(v) {
+			return false
+		}
+		if cmp.v.Pre != "" && cmp.v.Major == v.Major && cmp.v.Minor == v.Minor && cmp.v.Patch == v.Patch {
+			preAllowed = true
+		}
+	}
+	return preAllowed
+}
+
+func (cmp comparator) matches(v Version) bool {
+	c := Compare(v, cmp.v)
+	switch cmp.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
+
+func (c Constraint) String() string {
+	return c.original
+}
+
+// Highest returns the greatest of the given versions that satisfies the constraint.
+func (c Constraint) Highest(versions []Version) (Version, bool) {
+	var best Version
+	found := false
+	for _, v := range versions {
+		if c.Check(v) && (!found || Compare(v, best) > 0) {
+			best = v
+			found = true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,129 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Version struct {
+	Major    int
+	Minor    int
+	Patch    int
+	Pre      string // Pre-release identifiers, without the leading '-'
+	Original string // The string the version was parsed from, e.g. the tag name
+}
+
+// Parse reads a version such as "1.2.3", "v1.2.3" or "1.2.3-beta.1". Missing minor
+// and patch numbers default to zero, and build metadata is ignored.
+func Parse(s string) (Version, error) {
+	v, _, err := parsePartial(s)
+	return v, err
+}
+
+// parsePartial parses a possibly incomplete version and reports how many of the
+// major, minor and patch numbers were given.
+func parsePartial(s string) (Version, int, error) {
+	v := Version{Original: s}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if s == "" {
+		return v, 0, fmt.Errorf("invalid version: '%s'", v.Original)
+	}
+
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.Pre = s[i+1:]
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, 0, fmt.Errorf("invalid version: '%s'", v.Original)
+	}
+
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	given := 0
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, 0, fmt.Errorf("invalid version: '%s'", v.Original)
+		}
+		*numbers[i] = n
+		given++
+	}
+
+	return v, given, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 depending on whether a sorts before, equal to or after b.
+func Compare(a, b Version) int {
+	if c := compareInt(a.Major, b.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(a.Minor, b.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(a.Patch, b.Patch); c != 0 {
+		return c
+	}
+	return comparePre(a.Pre, b.Pre)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePre orders pre-release strings as described by semver.org: a release sorts
+// after any of its pre-releases, and identifiers are compared field by field.
+func comparePre(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInt(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1 // Numeric identifiers sort before alphanumeric ones
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(as), len(bs))
+}
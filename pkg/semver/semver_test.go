@@ -0,0 +1,162 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}},
+		{"v1.2.3", Version{Major: 1, Minor: 2, Patch: 3}},
+		{"1.2", Version{Major: 1, Minor: 2}},
+		{"1", Version{Major: 1}},
+		{"1.2.3-beta.1", Version{Major: 1, Minor: 2, Patch: 3, Pre: "beta.1"}},
+		{"1.2.3+build.5", Version{Major: 1, Minor: 2, Patch: 3}},
+		{"1.2.3-rc.1+build.5", Version{Major: 1, Minor: 2, Patch: 3, Pre: "rc.1"}},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", test.in, err)
+			continue
+		}
+		test.want.Original = test.in
+		if got != test.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+
+	for _, in := range []string{"", "v", "a.b.c", "1.2.3.4", "1..2", "-1.0.0", "1.2.z"} {
+		if v, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", in, v)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Each version sorts before the next one
+	ordered := []string{
+		"0.9.9",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, b := mustParse(t, ordered[i]), mustParse(t, ordered[j])
+			want := compareInt(i, j)
+			if got := Compare(a, b); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	equal := [][2]string{
+		{"1.2", "1.2.0"},
+		{"v1", "1.0.0"},
+		{"1.2.3+build.1", "1.2.3+build.2"},
+	}
+	for _, pair := range equal {
+		if got := Compare(mustParse(t, pair[0]), mustParse(t, pair[1])); got != 0 {
+			t.Errorf("Compare(%s, %s) = %d, want 0", pair[0], pair[1], got)
+		}
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0", "1.3.0-beta"}},
+		{"^1.2", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2", "1.0.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4", "0.1.0"}},
+		{"^0.0", []string{"0.0.0", "0.0.9"}, []string{"0.1.0"}},
+		{"^0", []string{"0.0.0", "0.9.9"}, []string{"1.0.0"}},
+		{"~1", []string{"1.0.0", "1.9.9"}, []string{"0.9.9", "2.0.0"}},
+		{"~1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0", "1.1.9"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0"}},
+		{"1.2", []string{"1.2.0", "1.2.7"}, []string{"1.3.0", "1.1.0"}},
+		{"1.2.0", []string{"1.2.0"}, []string{"1.2.1", "1.1.9"}},
+		{"=v1.2.0", []string{"1.2.0"}, []string{"1.2.1"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9", "1.2.0"}},
+		{"<=1.2", []string{"1.2.9", "1.0.0"}, []string{"1.3.0"}},
+		{">= 2.0 < 3.0", []string{"2.0.0", "2.9.9"}, []string{"1.9.9", "3.0.0"}},
+		{">=2.0, <3.0", []string{"2.5.0"}, []string{"3.0.0"}},
+		{"!=1.2.0", []string{"1.2.1"}, []string{"1.2.0"}},
+		{"*", []string{"0.0.1", "9.0.0"}, []string{"1.0.0-beta"}},
+		{"1.x", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"^1.2 || ^2.0", []string{"1.2.0", "2.5.0"}, []string{"1.1.0", "3.0.0"}},
+		{"<1.0 || >=3", []string{"0.5.0", "3.1.0"}, []string{"1.0.0", "2.9.9"}},
+
+		// Pre-releases only match a constraint naming one of the same version
+		{">=1.3.0-beta.1", []string{"1.3.0-beta.1", "1.3.0-beta.2", "1.3.0", "1.4.0"}, []string{"1.3.0-alpha", "1.4.0-beta.1"}},
+		{"^1.0.0-rc.1", []string{"1.0.0-rc.2", "1.0.0", "1.5.0"}, []string{"1.0.0-beta", "1.1.0-rc.1"}},
+		{"^1.0.0", []string{"1.0.0"}, []string{"1.0.0-rc.1", "1.1.0-rc.1"}},
+	}
+	for _, test := range tests {
+		c, err := ParseConstraint(test.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q) = %v", test.constraint, err)
+			continue
+		}
+		if c.String() != test.constraint {
+			t.Errorf("ParseConstraint(%q).String() = %q", test.constraint, c.String())
+		}
+		for _, v := range test.match {
+			if !c.Check(mustParse(t, v)) {
+				t.Errorf("%q doesn't match %s", test.constraint, v)
+			}
+		}
+		for _, v := range test.noMatch {
+			if c.Check(mustParse(t, v)) {
+				t.Errorf("%q matches %s", test.constraint, v)
+			}
+		}
+	}
+
+	for _, constraint := range []string{"", "  ", "^", ">=", "^1.2.3.4", "~a", ">=1.0 <", "^1 ||", "|| ^1", "1.2.z"} {
+		if _, err := ParseConstraint(constraint); err == nil {
+			t.Errorf("ParseConstraint(%q) succeeded, want an error", constraint)
+		}
+	}
+}
+
+func TestHighest(t *testing.T) {
+	c, err := ParseConstraint("~1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []Version
+	for _, v := range []string{"1.1.9", "1.2.0", "1.2.10", "1.2.2", "1.3.0", "1.2.11-beta"} {
+		versions = append(versions, mustParse(t, v))
+	}
+	best, ok := c.Highest(versions)
+	if !ok || best.String() != "1.2.10" {
+		t.Errorf("Highest = %s, %v, want 1.2.10", best, ok)
+	}
+	if _, ok := c.Highest(versions[:1]); ok {
+		t.Error("Highest found a version when none matches")
+	}
+}
+
+func mustParse(t *testing.T, s string) Version {
+	t.Helper()
+	v, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
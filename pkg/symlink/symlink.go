@@ -22,10 +22,13 @@ func CreateSymlink(source, target string) error {
 		return fmt.Errorf("failed to create parent directory '%s': %v", parentDir, err)
 	}
 
-	// Remove existing symlink/file if it exists
-	if _, err := os.Lstat(target); err == nil {
+	// Replace an existing symlink or empty directory, but never the user's files
+	if info, err := os.Lstat(target); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 && !info.IsDir() {
+			return fmt.Errorf("'%s' already exists and is not a link", target)
+		}
 		if err := os.Remove(target); err != nil {
-			return err
+			return fmt.Errorf("'%s' already exists and is not a link: %v", target, err)
 		}
 	}
 